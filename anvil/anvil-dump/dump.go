@@ -99,6 +99,9 @@ func (d *dumper) dump(indent string, id tagId) bool {
 	case tagIntArray:
 		d.dumpIntArray(indent, name)
 
+	case tagLongArray:
+		d.dumpLongArray(indent, name)
+
 	case tagString:
 		d.dumpString(indent, name)
 
@@ -159,6 +162,20 @@ func (d *dumper) dumpIntArray(indent, name string) {
 	fmt.Fprintf(d.w, "%s}\n", indent)
 }
 
+func (d *dumper) dumpLongArray(indent, name string) {
+	value := d.readLongArray()
+
+	fmt.Fprintf(d.w, "%s%s(%q) [%d] {\n", indent, tagLongArray, name, len(value))
+
+	if len(value) < 5 {
+		fmt.Fprintf(d.w, "%s%v\n", indent+"  ", value)
+	} else {
+		fmt.Fprintf(d.w, "%s%v...\n", indent+"  ", value[:5])
+	}
+
+	fmt.Fprintf(d.w, "%s}\n", indent)
+}
+
 func (d *dumper) dumpString(indent, name string) {
 	value := d.readString()
 
@@ -285,3 +302,21 @@ func (d *dumper) readIntArray() []int32 {
 
 	return v
 }
+
+func (d *dumper) readLongArray() []int64 {
+	size := d.readInt()
+	if size < 0 {
+		errorf("TAG_Long_Array with size < 0")
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	v := make([]int64, size)
+	for i := 0; i < int(size); i++ {
+		v[i] = d.readLong()
+	}
+
+	return v
+}
@@ -4,15 +4,25 @@
 package main
 
 import (
-	"compress/gzip"
-	"compress/zlib"
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+
+	"github.com/kpfaulkner/mctools/anvil"
 )
 
-// sectorSize defines the byte size of a single sector.
-const sectorSize = 4096
+const (
+	// sectorSize defines the byte size of a single sector.
+	sectorSize = 4096
+
+	// externalFlag is set on the compression scheme of chunks stored
+	// in a separate .mcc file.
+	externalFlag = 0x80
+)
 
 // dumpRegion reads a region file and extracts its NBT encoded chunk descriptors.
 func dumpRegion(w io.Writer, file string) error {
@@ -25,6 +35,8 @@ func dumpRegion(w io.Writer, file string) error {
 
 	defer fd.Close()
 
+	rx, rz, _ := anvil.RegionCoords(file)
+
 	_, err = io.ReadFull(fd, locations[:])
 	if err != nil {
 		return err
@@ -39,8 +51,14 @@ func dumpRegion(w io.Writer, file string) error {
 			continue
 		}
 
+		// Name of the file holding the chunk, should it be too large
+		// for the region.
+		cx := rx*anvil.ChunksPerRegion + (i/4)%anvil.ChunksPerRegion
+		cz := rz*anvil.ChunksPerRegion + (i/4)/anvil.ChunksPerRegion
+		mcc := filepath.Join(filepath.Dir(file), fmt.Sprintf("c.%d.%d%s", cx, cz, anvil.ExternalFileExtension))
+
 		fmt.Fprintf(w, "Chunk %d (offset: %d, sectors: %d):\n", i/4, offset, sectors)
-		err := dumpChunk(w, fd, offset)
+		err := dumpChunk(w, fd, offset, mcc)
 		if err != nil {
 			return err
 		}
@@ -50,35 +68,46 @@ func dumpRegion(w io.Writer, file string) error {
 }
 
 // dumpChunk extracts a compressed chunk from the given reader and
-// dumps its NBT tag contents.
-func dumpChunk(w io.Writer, r io.ReadSeeker, offset int64) error {
-	address := offset*sectorSize + 4
-	_, err := r.Seek(address, 0)
+// dumps its NBT tag contents. The data is read from file mcc instead,
+// if the chunk is marked as being stored externally.
+func dumpChunk(w io.Writer, r io.ReadSeeker, offset int64, mcc string) error {
+	_, err := r.Seek(offset*sectorSize, 0)
 	if err != nil {
 		return err
 	}
 
-	var scheme [1]byte
-	_, err = io.ReadFull(r, scheme[:])
+	// The data size includes the compression scheme.
+	var header [5]byte
+	_, err = io.ReadFull(r, header[:])
 	if err != nil {
 		return err
 	}
 
-	var rr io.ReadCloser
-	switch scheme[0] {
-	case 1:
-		rr, err = gzip.NewReader(r)
-	case 2:
-		rr, err = zlib.NewReader(r)
-	default:
-		return fmt.Errorf("chunk(%d); invalid compression scheme: %d", offset, scheme[0])
+	size := binary.BigEndian.Uint32(header[:])
+	scheme := header[4]
+
+	if size == 0 || size > 255*sectorSize {
+		return fmt.Errorf("chunk(%d); invalid data size: %d", offset, size)
+	}
+
+	var data []byte
+
+	if scheme&externalFlag != 0 {
+		scheme &^= externalFlag
+		data, err = ioutil.ReadFile(mcc)
+	} else {
+		data = make([]byte, size-1)
+		_, err = io.ReadFull(r, data)
 	}
 
 	if err != nil {
 		return err
 	}
 
-	err = dump(w, rr)
-	rr.Close()
-	return err
+	data, err = anvil.Decompress(scheme, data)
+	if err != nil {
+		return fmt.Errorf("chunk(%d); %v", offset, err)
+	}
+
+	return dump(w, bytes.NewReader(data))
 }
@@ -22,5 +22,6 @@ const (
 	tagList      tagId = 0x9
 	tagCompound  tagId = 0xa
 	tagIntArray  tagId = 0xb
+	tagLongArray tagId = 0xc
 	tagUnknown   tagId = 0xff
 )
@@ -0,0 +1,68 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kpfaulkner/mctools/anvil"
+)
+
+func main() {
+	files, repair := parseArgs()
+	status := 0
+
+	for _, file := range files {
+		var problems []anvil.Problem
+		var err error
+
+		if repair {
+			problems, err = anvil.RepairRegion(file)
+		} else {
+			problems, err = anvil.VerifyRegion(file)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			status = 1
+			continue
+		}
+
+		for _, p := range problems {
+			fmt.Printf("%s: %s\n", file, p)
+		}
+
+		if len(problems) > 0 && !repair {
+			status = 1
+		}
+	}
+
+	os.Exit(status)
+}
+
+// parseArgs parses and validates command line arguments.
+func parseArgs() ([]string, bool) {
+	flag.Usage = func() {
+		fmt.Println("usage:", os.Args[0], "[options] <file.mca>...")
+		flag.PrintDefaults()
+	}
+
+	repair := flag.Bool("repair", false, "Rewrite and compact files, leaving out damaged chunks and keeping a backup of the original.")
+	version := flag.Bool("version", false, "Display version information.")
+	flag.Parse()
+
+	if *version {
+		fmt.Println(Version())
+		os.Exit(0)
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	return flag.Args(), *repair
+}
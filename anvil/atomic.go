@@ -0,0 +1,124 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Suffixes for backup files, as used by Minecraft itself.
+const (
+	RegionBackupSuffix = ".bak"
+	LevelBackupSuffix  = "_old"
+)
+
+// writeFile safely replaces the contents of the given file with the data
+// written by fn.
+//
+// The data is written to a temporary file in the same directory, synced
+// to disk and then renamed over the original. A crash or error halfway
+// through leaves the original untouched.
+//
+// If backup is not empty, the previous version of the file is kept under
+// that name.
+func writeFile(file, backup string, fn func(*os.File) error) error {
+	dir, name := filepath.Split(file)
+	if len(dir) == 0 {
+		dir = "."
+	}
+
+	mode := os.FileMode(0644)
+	stat, err := os.Stat(file)
+	if err == nil {
+		mode = stat.Mode().Perm()
+	}
+
+	fd, err := ioutil.TempFile(dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+
+	tmp := fd.Name()
+
+	err = fn(fd)
+	if err == nil {
+		err = fd.Chmod(mode)
+	}
+
+	if err == nil {
+		err = fd.Sync()
+	}
+
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil && len(backup) > 0 && stat != nil {
+		err = backupFile(file, backup)
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// backupFile replaces backup with the current contents of file.
+func backupFile(file, backup string) error {
+	err := os.Remove(backup)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// A hard link is cheap and keeps the old data around once the original
+	// is replaced. Fall back to a copy on file systems without them.
+	if os.Link(file, backup) == nil {
+		return nil
+	}
+
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := os.Create(backup)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// syncDir flushes directory entries to disk, so a rename survives a crash.
+// Not all platforms support this, so errors are ignored.
+func syncDir(dir string) {
+	fd, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	fd.Sync()
+	fd.Close()
+}
@@ -5,6 +5,8 @@
 
 package biome
 
+import "strings"
+
 // ref: http://minecraft.gamepedia.com/Biome
 
 // Id defines a biome id.
@@ -74,3 +76,17 @@ const (
 	MesaPlateau         Id = 39
 	MesaPlateauM        Id = 167
 )
+
+// Parse returns the biome with the given name, as yielded by Id.String.
+// Names are matched without regard to case. Returns false if the name
+// is not known.
+func Parse(name string) (Id, bool) {
+	for i := 0; i < 256; i++ {
+		id := Id(i)
+		if !strings.HasPrefix(id.String(), "Id(") && strings.EqualFold(id.String(), name) {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
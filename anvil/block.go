@@ -8,6 +8,7 @@ import "github.com/kpfaulkner/mctools/anvil/item"
 // Block represents a single block.
 type Block struct {
 	Id         item.Id // The complete block id.
+	State      string  // Namespaced block state; e.g.: minecraft:oak_log[axis=y]
 	BlockLight uint8   // Amount of block-emitted light.
 	SkyLight   uint8   // Amount of sunlight or moonlight hitting the block.
 }
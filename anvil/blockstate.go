@@ -0,0 +1,96 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kpfaulkner/mctools/anvil/nbt"
+)
+
+// DefaultNamespace is the namespace assumed for block names without one.
+const DefaultNamespace = "minecraft"
+
+// BlockState describes a block type by its namespaced name, along with
+// the properties defining its state. E.g.: minecraft:oak_log[axis=y]
+//
+// These make up the palette of sections in Minecraft 1.13+.
+type BlockState struct {
+	Name       string       `nbt:"Name"`
+	Properties nbt.Compound `nbt:"Properties,omitempty"`
+}
+
+// ParseBlockState parses a block state from its string representation.
+// This is in the form: namespace:name[key=value,key=value]
+//
+// The namespace defaults to "minecraft" if omitted. Properties are
+// optional. Returns false if the string is not valid.
+func ParseBlockState(v string) (BlockState, bool) {
+	var bs BlockState
+
+	v = strings.TrimSpace(v)
+	name, props := v, ""
+
+	if n := strings.IndexByte(v, '['); n > -1 {
+		if !strings.HasSuffix(v, "]") {
+			return bs, false
+		}
+
+		name, props = v[:n], v[n+1:len(v)-1]
+	}
+
+	if len(name) == 0 || strings.ContainsAny(name, "[]=,") {
+		return bs, false
+	}
+
+	if !strings.Contains(name, ":") {
+		name = DefaultNamespace + ":" + name
+	}
+
+	bs.Name = name
+
+	if len(props) == 0 {
+		return bs, true
+	}
+
+	for _, p := range strings.Split(props, ",") {
+		kv := strings.Split(p, "=")
+		if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			return BlockState{}, false
+		}
+
+		bs.Properties.Set(kv[0], kv[1])
+	}
+
+	return bs, true
+}
+
+// Property returns the value of the given property.
+// Returns an empty string if the property is not set.
+func (bs *BlockState) Property(name string) string {
+	v, ok := bs.Properties.Get(name)
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprint(v)
+}
+
+// String returns the block state in the form name[key=value,...].
+// Properties are sorted by key, so equal states yield equal strings.
+func (bs BlockState) String() string {
+	if len(bs.Properties) == 0 {
+		return bs.Name
+	}
+
+	props := make([]string, len(bs.Properties))
+	for i, t := range bs.Properties {
+		props[i] = fmt.Sprintf("%s=%v", t.Name, t.Value)
+	}
+
+	sort.Strings(props)
+	return bs.Name + "[" + strings.Join(props, ",") + "]"
+}
@@ -3,12 +3,11 @@
 
 package anvil
 
-import "time"
+import (
+	"time"
 
-// Known chunk compression schemes.
-const (
-	GZip = 1
-	ZLib = 2
+	"github.com/kpfaulkner/mctools/anvil/biome"
+	"github.com/kpfaulkner/mctools/anvil/nbt"
 )
 
 // Tile Ticks represent block updates that need to happen because they could
@@ -22,16 +21,20 @@ const (
 // For map makers, tile ticks can be used to update blocks after a period of
 // time has passed with the chunk loaded into memory.
 type TileTick struct {
-	Id string `nbt:"i"`
-	T  int32  `nbt:"t"`
-	P  int32  `nbt:"p"`
-	X  int32  `nbt:"x"`
-	Y  int32  `nbt:"Y"`
-	Z  int32  `nbt:"Z"`
+	Id      string       `nbt:"i"`
+	T       int32        `nbt:"t"`
+	P       int32        `nbt:"p"`
+	X       int32        `nbt:"x"`
+	Y       int32        `nbt:"Y"`
+	Z       int32        `nbt:"Z"`
+	Unknown nbt.Compound `nbt:",remain"`
 }
 
 // Chunk represents a single chunk in a region file.
 //
+// Tags not covered by the fields below are kept in Unknown and written
+// back unchanged when the chunk is saved.
+//
 // Reference: http://minecraft.gamepedia.com/Chunk_format
 type Chunk struct {
 	Entities         []Entity     `nbt:"Entities"`
@@ -47,6 +50,10 @@ type Chunk struct {
 	V                int8         `nbt:"V"`
 	LightPopulated   bool         `nbt:"LightPopulated"`
 	TerrainPopulated bool         `nbt:"TerrainPopulated"`
+	DataVersion      int32        `nbt:"-"` // Stored outside the Level compound; 0 for old chunks.
+	Unknown          nbt.Compound `nbt:",remain"`
+
+	root nbt.Compound // Unknown tags outside the Level compound.
 }
 
 // Init initializes the chunk to a default, empty state.
@@ -64,6 +71,9 @@ func (c *Chunk) Init(x, z int) {
 	c.Entities = nil
 	c.TileEntities = nil
 	c.TileTicks = nil
+	c.Unknown = nil
+	c.root = nil
+	c.DataVersion = 0
 	c.V = 1
 
 	// Reset biomes.
@@ -72,6 +82,31 @@ func (c *Chunk) Init(x, z int) {
 	}
 }
 
+// Clone returns a copy of the chunk. Sections, biomes and the height map
+// are copied, so blocks in the copy can be changed without affecting c.
+// Entities, tile entities, tile ticks and unknown tags are shared with c;
+// replace them in the copy, rather than changing them in place.
+func (c *Chunk) Clone() *Chunk {
+	out := *c
+
+	if c.Biomes != nil {
+		out.Biomes = append(make([]int8, 0, len(c.Biomes)), c.Biomes...)
+	}
+
+	if c.HeightMap != nil {
+		out.HeightMap = append(make([]int32, 0, len(c.HeightMap)), c.HeightMap...)
+	}
+
+	if c.Sections != nil {
+		out.Sections = make([]Section, len(c.Sections))
+		for i := range c.Sections {
+			out.Sections[i] = c.Sections[i].Clone()
+		}
+	}
+
+	return &out
+}
+
 // Section returns the section for the given Y coordinate.
 // The coordinate is expected to be in the range 0-255 (MaxChunkHeight-1).
 //
@@ -81,7 +116,11 @@ func (c *Chunk) Init(x, z int) {
 // Returns nil if the coordinate is invalid.
 // Returns nil if the section has not yet been generated and create is false.
 func (c *Chunk) Section(y int, create bool) *Section {
-	index := byte(y / SectionsPerChunk)
+	if y < 0 || y >= MaxChunkHeight {
+		return nil
+	}
+
+	index := int8(y / SectionsPerChunk)
 
 	for i := range c.Sections {
 		if c.Sections[i].Y == index {
@@ -96,10 +135,49 @@ func (c *Chunk) Section(y int, create bool) *Section {
 	sz := len(c.Sections)
 	c.Sections = append(c.Sections, Section{})
 	s := &c.Sections[sz]
-	s.Init(index)
+
+	if c.DataVersion >= DataVersionFlattening {
+		s.InitPalette(index)
+		s.span = c.DataVersion < DataVersionPadded
+	} else {
+		s.Init(index)
+	}
+
 	return s
 }
 
+// Biome returns the biome for the given block coordinates in this chunk.
+// The x and z coordinates are expected to be in the range 0-15, y in the
+// range 0-255 (MaxChunkHeight-1).
+//
+// Worlds from before Minecraft 1.15 store a biome for each column and
+// ignore y. Newer worlds store a biome for each 4x4x4 cell.
+//
+// Returns false if the coordinates are invalid, or the chunk holds no
+// biome data.
+func (c *Chunk) Biome(x, y, z int) (biome.Id, bool) {
+	if x < 0 || x >= BlocksPerChunk || z < 0 || z >= BlocksPerChunk || y < 0 || y >= MaxChunkHeight {
+		return 0, false
+	}
+
+	if len(c.Biomes) == BlocksPerChunk*BlocksPerChunk {
+		return biome.Id(c.Biomes[z*BlocksPerChunk+x]), true
+	}
+
+	// Palette-based chunks keep their biomes in Unknown.
+	v, _ := c.Unknown.Get("Biomes")
+	ids, _ := v.([]int32)
+
+	switch len(ids) {
+	case BlocksPerChunk * BlocksPerChunk:
+		return biome.Id(ids[z*BlocksPerChunk+x]), true
+	case MaxChunkHeight / 4 * 16:
+		return biome.Id(ids[(y>>2)*16+(z>>2)*4+(x>>2)]), true
+	}
+
+	return 0, false
+}
+
 // UpdateHeightmap refills the heightmap with current block data.
 // Each value in the heightmap records the lowest level in each column where
 // the light from the sky is at full strength.
@@ -0,0 +1,188 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/kpfaulkner/mctools/anvil/biome"
+	"github.com/kpfaulkner/mctools/anvil/item"
+	"github.com/kpfaulkner/mctools/anvil/nbt"
+)
+
+func TestChunkUnknown(t *testing.T) {
+	var a, b Chunk
+	a.Init(1, 2)
+	a.Section(0, true).Write(1, 2, 3, &Block{Id: item.Stone})
+	a.Unknown.Set("Status", "full")
+	a.root.Set("ForgeDataVersion", nbt.Compound{{Name: "minecraft", Value: int32(1343)}})
+	a.DataVersion = 1343
+	a.Entities = []Entity{{
+		Id:  "EntityHorse",
+		Pos: []float64{1, 2, 3},
+		Unknown: nbt.Compound{
+			{Name: "Tame", Value: int8(1)},
+			{Name: "Items", Value: nbt.List{Values: []interface{}{
+				nbt.Compound{{Name: "id", Value: "minecraft:saddle"}},
+			}}},
+		},
+	}}
+
+	var cd ChunkDescriptor
+	cd.scheme = ZLib
+
+	if !cd.Write(&a) {
+		t.Fatalf("write failed")
+	}
+
+	if !cd.Read(&b) {
+		t.Fatalf("read failed")
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("roundtrip mismatch:\nHave: %+v\nWant: %+v", b, a)
+	}
+}
+
+func TestChunkFlat(t *testing.T) {
+	for _, version := range []int32{1631, 2586} {
+		var a, b Chunk
+		a.Init(1, 2)
+		a.DataVersion = version
+		a.HeightMap = nil
+		a.Biomes = nil
+		a.Unknown.Set("Status", "full")
+		a.Unknown.Set("Biomes", make([]int32, 1024))
+		a.Section(17, true).Write(1, 2, 3, &Block{State: "minecraft:oak_log[axis=y]"})
+
+		// Lighting data below the world, as stored since 1.14.
+		a.Sections = append(a.Sections, Section{Y: -1, SkyLight: make([]uint8, 2048)})
+
+		var cd ChunkDescriptor
+		if err := cd.Encode(&a); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := cd.Decode(&b); err != nil {
+			t.Fatal(err)
+		}
+
+		if b.DataVersion != version || b.X != 1 || b.Z != 2 {
+			t.Fatalf("version %d: header mismatch: %+v", version, b)
+		}
+
+		if !reflect.DeepEqual(a.Unknown, b.Unknown) {
+			t.Fatalf("version %d: unknown mismatch:\nHave: %v\nWant: %v", version, b.Unknown, a.Unknown)
+		}
+
+		var block Block
+		s := b.Section(17, false)
+		if s == nil || !s.Read(1, 2, 3, &block) {
+			t.Fatalf("version %d: section missing", version)
+		}
+
+		if block.State != "minecraft:oak_log[axis=y]" {
+			t.Fatalf("version %d: block mismatch: %q", version, block.State)
+		}
+
+		if !reflect.DeepEqual(a.Sections[0].BlockStates, s.BlockStates) {
+			t.Fatalf("version %d: block states mismatch", version)
+		}
+
+		if len(b.Sections) != 2 || b.Sections[1].Y != -1 {
+			t.Fatalf("version %d: lighting section mismatch: %+v", version, b.Sections)
+		}
+	}
+}
+
+func TestChunkVersion(t *testing.T) {
+	var c Chunk
+	c.Init(0, 0)
+	c.DataVersion = DataVersionNoLevel
+
+	var cd ChunkDescriptor
+	err := cd.Encode(&c)
+
+	if _, ok := err.(*VersionError); !ok {
+		t.Fatalf("expected version error; have %v", err)
+	}
+
+	c.DataVersion = 0
+	c.V = 0
+
+	if _, ok := cd.Encode(&c).(*VersionError); !ok {
+		t.Fatalf("expected version error for V=0")
+	}
+}
+
+func TestChunkBiome(t *testing.T) {
+	var c Chunk
+	c.Init(0, 0)
+	c.Biomes[3*16+2] = int8(biome.Jungle)
+
+	if b, ok := c.Biome(2, 100, 3); !ok || b != biome.Jungle {
+		t.Fatalf("biome mismatch: want %v; have %v", biome.Jungle, b)
+	}
+
+	// Palette-based chunks from 1.15 onwards store 4x4x4 cells.
+	cells := make([]int32, 1024)
+	cells[(64>>2)*16+(3>>2)*4+(6>>2)] = int32(biome.Desert)
+
+	c.Biomes = nil
+	c.Unknown.Set("Biomes", cells)
+
+	if b, ok := c.Biome(6, 64, 3); !ok || b != biome.Desert {
+		t.Fatalf("biome mismatch: want %v; have %v", biome.Desert, b)
+	}
+
+	if _, ok := c.Biome(16, 0, 0); ok {
+		t.Fatalf("expected failure for invalid coordinates")
+	}
+}
+
+func TestReadVersion(t *testing.T) {
+	for _, tc := range []struct {
+		dataVersion int32
+		v           int8
+	}{
+		{0, 1},
+		{1343, 1},
+		{1631, 0},
+		{2586, 0},
+	} {
+		var c Chunk
+		c.Init(0, 0)
+		c.DataVersion = tc.dataVersion
+		c.V = tc.v
+		c.Section(0, true).Write(1, 2, 3, &Block{Id: item.Stone})
+		c.Entities = []Entity{{Id: "Pig", Pos: []float64{1, 2, 3}}}
+
+		codec, err := codecFor(c.DataVersion, c.V)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err = codec.encode(&buf, &c); err != nil {
+			t.Fatal(err)
+		}
+
+		data := buf.Bytes()
+
+		dataVersion, v, err := readVersion(data)
+		if err != nil {
+			t.Fatalf("%+v: %v", tc, err)
+		}
+
+		if dataVersion != tc.dataVersion || (dataVersion == 0 && v != tc.v) {
+			t.Fatalf("%+v: version mismatch: have %d, %d", tc, dataVersion, v)
+		}
+
+		if _, _, err = readVersion(data[:len(data)/2]); err == nil {
+			t.Fatalf("%+v: expected error for truncated data", tc)
+		}
+	}
+}
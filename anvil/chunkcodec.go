@@ -0,0 +1,201 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/kpfaulkner/mctools/anvil/nbt"
+)
+
+// Chunk data versions at which the chunk format changed in a way
+// relevant to this package.
+//
+// Ref: http://minecraft.gamepedia.com/Data_version
+const (
+	DataVersionFlattening = 1451 // 17w47a (1.13): palette-based sections.
+	DataVersionPadded     = 2529 // 20w17a (1.16): palette indices no longer span two longs.
+	DataVersionNoLevel    = 2844 // 21w43a (1.18): chunk data moved out of the Level compound.
+)
+
+// VersionError is returned when chunk data is stored in a format this
+// package can not read or write.
+type VersionError struct {
+	DataVersion int32 // DataVersion of the chunk; 0 if absent.
+	V           int8  // Legacy version field of the chunk; 0 if absent.
+}
+
+func (e *VersionError) Error() string {
+	if e.DataVersion > 0 {
+		return fmt.Sprintf("anvil: unsupported chunk data version %d", e.DataVersion)
+	}
+
+	return fmt.Sprintf("anvil: unsupported chunk version V=%d", e.V)
+}
+
+// chunkCodec translates between the NBT data of a chunk and the Chunk
+// type, for a specific range of data versions.
+type chunkCodec interface {
+	decode(r io.Reader, c *Chunk) error
+	encode(w io.Writer, c *Chunk) error
+}
+
+// codecFor returns the codec for chunks with the given version fields.
+func codecFor(dataVersion int32, v int8) (chunkCodec, error) {
+	switch {
+	case dataVersion >= DataVersionNoLevel:
+	case dataVersion >= DataVersionFlattening:
+		return flatCodec{}, nil
+	case dataVersion > 0, v == 1:
+		return legacyCodec{}, nil
+	}
+
+	return nil, &VersionError{DataVersion: dataVersion, V: v}
+}
+
+// detectCodec reads the version fields from the given NBT data and
+// returns the matching codec.
+func detectCodec(data []byte) (chunkCodec, error) {
+	dataVersion, v, err := readVersion(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return codecFor(dataVersion, v)
+}
+
+// versionRoot defines the version fields in the root compound of a chunk.
+// All other tags are skipped when decoding into it.
+type versionRoot struct {
+	Level struct {
+		V int8 `nbt:"V"`
+	}
+	DataVersion int32 `nbt:"DataVersion,omitempty"`
+}
+
+// readVersion reads the DataVersion and Level.V tags from the given,
+// uncompressed NBT data of a chunk.
+func readVersion(data []byte) (int32, int8, error) {
+	var v versionRoot
+
+	err := nbt.Unmarshal(bytes.NewReader(data), &v)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return v.DataVersion, v.Level.V, nil
+}
+
+// legacyCodec handles chunks from before Minecraft 1.13, which store
+// numeric block ids.
+type legacyCodec struct{}
+
+// legacyRoot defines the root compound of a legacy chunk.
+type legacyRoot struct {
+	Level       *Chunk
+	DataVersion int32        `nbt:"DataVersion,omitempty"`
+	Unknown     nbt.Compound `nbt:",remain"`
+}
+
+func (legacyCodec) decode(r io.Reader, c *Chunk) error {
+	var v legacyRoot
+	v.Level = c
+
+	err := nbt.Unmarshal(r, &v)
+	if err != nil {
+		return err
+	}
+
+	c.DataVersion = v.DataVersion
+	c.root = v.Unknown
+	return nil
+}
+
+func (legacyCodec) encode(w io.Writer, c *Chunk) error {
+	var v legacyRoot
+	v.Level = c
+	v.DataVersion = c.DataVersion
+	v.Unknown = c.root
+	return nbt.Marshal(w, v)
+}
+
+// flatCodec handles chunks from Minecraft 1.13 up to 1.18, which store
+// palette-based sections.
+type flatCodec struct{}
+
+// flatRoot defines the root compound of a palette-based chunk.
+type flatRoot struct {
+	Level       *flatLevel
+	DataVersion int32
+	Unknown     nbt.Compound `nbt:",remain"`
+}
+
+// flatLevel defines the Level compound of a palette-based chunk.
+//
+// Fields which differ in type or meaning from the legacy format, like
+// Biomes and Heightmaps, are kept in Unknown.
+type flatLevel struct {
+	Entities      []Entity     `nbt:"Entities"`
+	TileEntities  []TileEntity `nbt:"TileEntities"`
+	TileTicks     []TileTick   `nbt:"TileTicks,omitempty"`
+	Sections      []Section    `nbt:"Sections"`
+	LastUpdate    int64        `nbt:"LastUpdate"`
+	InhabitedTime int64        `nbt:"InhabitedTime"`
+	X             int32        `nbt:"xPos"`
+	Z             int32        `nbt:"zPos"`
+	Unknown       nbt.Compound `nbt:",remain"`
+}
+
+func (flatCodec) decode(r io.Reader, c *Chunk) error {
+	var v flatRoot
+	v.Level = new(flatLevel)
+
+	err := nbt.Unmarshal(r, &v)
+	if err != nil {
+		return err
+	}
+
+	l := v.Level
+	c.Entities = l.Entities
+	c.TileEntities = l.TileEntities
+	c.TileTicks = l.TileTicks
+	c.Sections = l.Sections
+	c.LastUpdate = l.LastUpdate
+	c.InhabitedTime = l.InhabitedTime
+	c.X = l.X
+	c.Z = l.Z
+	c.Unknown = l.Unknown
+	c.DataVersion = v.DataVersion
+	c.root = v.Unknown
+
+	// Fill the palette caches up front, so reading blocks does not
+	// modify the chunk.
+	for i := range c.Sections {
+		c.Sections[i].span = c.DataVersion < DataVersionPadded
+		c.Sections[i].cacheStates()
+	}
+
+	return nil
+}
+
+func (flatCodec) encode(w io.Writer, c *Chunk) error {
+	var v flatRoot
+	v.DataVersion = c.DataVersion
+	v.Unknown = c.root
+	v.Level = &flatLevel{
+		Entities:      c.Entities,
+		TileEntities:  c.TileEntities,
+		TileTicks:     c.TileTicks,
+		Sections:      c.Sections,
+		LastUpdate:    c.LastUpdate,
+		InhabitedTime: c.InhabitedTime,
+		X:             c.X,
+		Z:             c.Z,
+		Unknown:       c.Unknown,
+	}
+
+	return nbt.Marshal(w, v)
+}
@@ -5,13 +5,8 @@ package anvil
 
 import (
 	"bytes"
-	"compress/gzip"
-	"compress/zlib"
-	"io"
 	"math"
 	"time"
-
-	"github.com/kpfaulkner/mctools/anvil/nbt"
 )
 
 // ChunkDescriptor describes a single chunk as stored in a region.
@@ -20,32 +15,63 @@ type ChunkDescriptor struct {
 	LastModified time.Time // Last time thischunk was modified.
 	X, Z         int       // Chunk coordinates in region.
 	scheme       byte      // Compression scheme.
+	sector       int       // Sector offset in the region file; 0 if not stored yet.
+	sectors      int       // Number of sectors allocated in the region file.
+	dirty        bool      // Data has changed since it was last stored.
 }
 
-// SectorCount returns the number of sectors this chunk occupies.
+// SectorCount returns the number of sectors this chunk occupies in
+// its region. This includes the length and compression scheme prefixing
+// the data. Chunks stored in an external file occupy a single sector.
 func (cd *ChunkDescriptor) SectorCount() int {
-	return int(math.Ceil(float64(len(cd.data)) / sectorSize))
+	if cd.data == nil {
+		return cd.sectors
+	}
+
+	if cd.external() {
+		return 1
+	}
+
+	return cd.dataSectors()
+}
+
+// dataSectors returns the number of sectors needed for the chunk data.
+func (cd *ChunkDescriptor) dataSectors() int {
+	return int(math.Ceil(float64(len(cd.data)+chunkHeaderSize) / sectorSize))
+}
+
+// external returns true if the chunk is too large to fit in its region
+// and must be stored in a separate file.
+func (cd *ChunkDescriptor) external() bool {
+	return cd.data != nil && cd.dataSectors() > maxChunkSectors
+}
+
+// loaded returns true if the chunk data has been read from the region file.
+func (cd *ChunkDescriptor) loaded() bool {
+	return cd.data != nil || cd.sector == 0
 }
 
 // Read decompresses chunk data into the given structure.
-// Returns false if ther eis no data or the decompression failed.
+// Returns false if there is no data or the decompression failed.
+//
+// Use Decode to find out why the chunk could not be read.
 func (cd *ChunkDescriptor) Read(c *Chunk) bool {
-	var r io.ReadCloser
-	var err error
-
-	buf := bytes.NewBuffer(cd.data)
-
-	switch cd.scheme {
-	case GZip:
-		r, err = gzip.NewReader(buf)
-	case ZLib:
-		r, err = zlib.NewReader(buf)
-	default:
-		return false
+	return cd.Decode(c) == nil
+}
+
+// Decode decompresses chunk data into the given structure.
+//
+// The chunk format is selected from the DataVersion and V fields in
+// the data. A *VersionError is returned if the format is not supported.
+func (cd *ChunkDescriptor) Decode(c *Chunk) error {
+	data, err := Decompress(cd.scheme, cd.data)
+	if err != nil {
+		return err
 	}
 
+	codec, err := detectCodec(data)
 	if err != nil {
-		return false
+		return err
 	}
 
 	// Clear out existing data; the nbt decoder will append to the existing slices.
@@ -55,41 +81,58 @@ func (cd *ChunkDescriptor) Read(c *Chunk) bool {
 	c.Entities = nil
 	c.TileEntities = nil
 	c.TileTicks = nil
+	c.Unknown = nil
+	c.DataVersion = 0
+	c.V = 0
+	c.LightPopulated = false
+	c.TerrainPopulated = false
 
-	var v struct {
-		Level *Chunk
-	}
-	v.Level = c
-
-	err = nbt.Unmarshal(r, &v)
-	r.Close()
-
-	if err != nil {
-		return false
-	}
-
-	return true
+	return codec.decode(bytes.NewReader(data), c)
 }
 
 // Write compresses the given chunk and writes the data into the current
 // chunk descriptor.
+//
+// Use Encode to find out why the chunk could not be written.
 func (cd *ChunkDescriptor) Write(c *Chunk) bool {
-	cd.LastModified = time.Now()
+	return cd.Encode(c) == nil
+}
+
+// Encode compresses the given chunk with ZLib and writes the data into
+// the current chunk descriptor. The chunk is written in the format
+// matching its DataVersion and V fields.
+func (cd *ChunkDescriptor) Encode(c *Chunk) error {
+	return cd.EncodeScheme(c, ZLib, DefaultCompression)
+}
+
+// EncodeScheme compresses the given chunk with the specified compression
+// scheme and level, and writes the data into the current chunk descriptor.
+// The level applies to GZip and ZLib only; see Compress.
+func (cd *ChunkDescriptor) EncodeScheme(c *Chunk, scheme byte, level int) error {
+	codec, err := codecFor(c.DataVersion, c.V)
+	if err != nil {
+		return err
+	}
+
+	lastModified := time.Now()
 
 	c.UpdateHeightmap()
-	c.LastUpdate = cd.LastModified.Unix()
+	c.LastUpdate = lastModified.Unix()
 
 	var buf bytes.Buffer
-	w := zlib.NewWriter(&buf)
 
-	var v struct {
-		Level *Chunk
+	err = codec.encode(&buf, c)
+	if err != nil {
+		return err
 	}
-	v.Level = c
 
-	err := nbt.Marshal(w, v)
-	w.Close()
+	data, err := Compress(scheme, level, buf.Bytes())
+	if err != nil {
+		return err
+	}
 
-	cd.data = buf.Bytes()
-	return err == nil
+	cd.LastModified = lastModified
+	cd.data = data
+	cd.scheme = scheme
+	return nil
 }
@@ -0,0 +1,129 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"io/ioutil"
+)
+
+// Known chunk compression schemes.
+const (
+	GZip         = 1
+	ZLib         = 2
+	Uncompressed = 3 // Minecraft 1.15.1+
+	LZ4          = 4 // Minecraft 1.20.5+
+)
+
+// DefaultCompression selects the default compression level for GZip
+// and ZLib data.
+const DefaultCompression = zlib.DefaultCompression
+
+// Decompress decompresses chunk data stored with the given compression
+// scheme.
+func Decompress(scheme byte, data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+
+	switch scheme {
+	case GZip:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case ZLib:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	case Uncompressed:
+		return data, nil
+	case LZ4:
+		return lz4Decode(data)
+	default:
+		return nil, fmt.Errorf("anvil: unknown compression scheme %d", scheme)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := ioutil.ReadAll(r)
+	r.Close()
+
+	// Older versions of this package wrote chunks which lacked the last
+	// byte of their checksum. Minecraft does not verify it, so neither
+	// do we, provided the rest of the data is intact.
+	if err == io.ErrUnexpectedEOF && scheme == ZLib {
+		if full, ok := inflateShortChecksum(data); ok {
+			return full, nil
+		}
+	}
+
+	return out, err
+}
+
+// inflateShortChecksum decompresses the given ZLib data, which is expected
+// to hold a complete deflate stream, followed by no more than part of its
+// checksum. The bytes of the checksum which are present must match the
+// decompressed data.
+//
+// Returns false if the data is damaged in any other way.
+func inflateShortChecksum(data []byte) ([]byte, bool) {
+	if len(data) < 2 {
+		return nil, false
+	}
+
+	r := bytes.NewReader(data[2:])
+	fr := flate.NewReader(r)
+	out, err := ioutil.ReadAll(fr)
+	fr.Close()
+
+	if err != nil || r.Len() >= 4 {
+		return nil, false
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], adler32.Checksum(out))
+
+	if !bytes.Equal(data[len(data)-r.Len():], sum[:r.Len()]) {
+		return nil, false
+	}
+
+	return out, true
+}
+
+// Compress compresses chunk data with the given compression scheme.
+// The level applies to GZip and ZLib only. It is one of the levels
+// defined in package compress/flate, or DefaultCompression.
+func Compress(scheme byte, level int, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+
+	switch scheme {
+	case GZip:
+		w, err = gzip.NewWriterLevel(&buf, level)
+	case ZLib:
+		w, err = zlib.NewWriterLevel(&buf, level)
+	case Uncompressed:
+		return data, nil
+	case LZ4:
+		return lz4Encode(data), nil
+	default:
+		return nil, fmt.Errorf("anvil: unknown compression scheme %d", scheme)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	return buf.Bytes(), err
+}
@@ -0,0 +1,126 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestXXH32(t *testing.T) {
+	for _, v := range []struct {
+		In   string
+		Seed uint32
+		Want uint32
+	}{
+		{"", 0, 0x02cc5d05},
+		{"abc", 0, 0x32d153ff},
+		{"Nobody inspects the spammish repetition", 0, 0xe2293b2f},
+	} {
+		if have := xxh32([]byte(v.In), v.Seed); have != v.Want {
+			t.Fatalf("%q: hash mismatch: have %08x, want %08x", v.In, have, v.Want)
+		}
+	}
+}
+
+func TestLZ4DecompressBlock(t *testing.T) {
+	// Four literals, an overlapping match of 8 bytes at offset 4 and
+	// a final literal.
+	src := []byte{0x44, 'a', 'b', 'c', 'd', 4, 0, 0x10, 'x'}
+	want := []byte("abcdabcdabcdx")
+
+	have := make([]byte, len(want))
+	if err := lz4DecompressBlock(have, src); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(have, want) {
+		t.Fatalf("mismatch: have %q, want %q", have, want)
+	}
+
+	if err := lz4DecompressBlock(have, src[:6]); err == nil {
+		t.Fatalf("expected error for truncated block")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	// Data spanning several LZ4 blocks, with both repetitive and
+	// incompressible parts.
+	data := make([]byte, 200000)
+	for i := range data {
+		if i < len(data)/2 {
+			data[i] = byte(i % 7)
+		} else {
+			data[i] = byte((i * 2654435761) >> 13)
+		}
+	}
+
+	for _, scheme := range []byte{GZip, ZLib, Uncompressed, LZ4} {
+		packed, err := Compress(scheme, DefaultCompression, data)
+		if err != nil {
+			t.Fatalf("scheme %d: %v", scheme, err)
+		}
+
+		have, err := Decompress(scheme, packed)
+		if err != nil {
+			t.Fatalf("scheme %d: %v", scheme, err)
+		}
+
+		if !bytes.Equal(have, data) {
+			t.Fatalf("scheme %d: roundtrip mismatch", scheme)
+		}
+
+		if scheme != Uncompressed && len(packed) > len(data)*3/4 {
+			t.Fatalf("scheme %d: poor compression: %d of %d bytes", scheme, len(packed), len(data))
+		}
+	}
+
+	if _, err := Compress(5, DefaultCompression, data); err == nil {
+		t.Fatalf("expected error for unknown scheme")
+	}
+}
+
+func TestDecompressShortChecksum(t *testing.T) {
+	data := bytes.Repeat([]byte("chunk data "), 1000)
+
+	packed, err := Compress(ZLib, DefaultCompression, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing checksum bytes are tolerated.
+	for n := 1; n <= 4; n++ {
+		have, err := Decompress(ZLib, packed[:len(packed)-n])
+		if err != nil {
+			t.Fatalf("%d bytes missing: %v", n, err)
+		}
+
+		if !bytes.Equal(have, data) {
+			t.Fatalf("%d bytes missing: data mismatch", n)
+		}
+	}
+
+	// A mismatching partial checksum is not.
+	bad := append([]byte(nil), packed[:len(packed)-1]...)
+	bad[len(bad)-1] ^= 0xff
+
+	if _, err := Decompress(ZLib, bad); err == nil {
+		t.Fatalf("expected error for corrupt checksum")
+	}
+
+	// Nor is a truncated deflate stream.
+	if _, err := Decompress(ZLib, packed[:len(packed)/2]); err == nil {
+		t.Fatalf("expected error for truncated data")
+	}
+
+	// Nor are truncated streams in other schemes.
+	packed, err = Compress(GZip, DefaultCompression, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decompress(GZip, packed[:len(packed)-1]); err == nil {
+		t.Fatalf("expected error for truncated gzip data")
+	}
+}
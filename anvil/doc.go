@@ -9,6 +9,10 @@ This library allows loading, modifying and saving of all the information.
 This means it can be used to analyze the contents of a world, but also change
 it to create new worlds.
 
+Chunks are read and written according to their DataVersion. Chunks from
+before Minecraft 1.13 use numeric block ids; chunks from 1.13 up to 1.18
+use palette-based block states. Newer chunks are rejected with a VersionError.
+
 
 Warning
 
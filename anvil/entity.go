@@ -5,46 +5,52 @@ package anvil
 
 import (
 	"github.com/kpfaulkner/mctools/anvil/item"
+	"github.com/kpfaulkner/mctools/anvil/nbt"
 )
 
 // Modifier defines an attribute modifier.
 type Modifier struct {
-	Name      string  `nbt:"Name"`
-	UUIDLeast int64   `nbt:"UUIDLeast"`
-	UUIDMost  int64   `nbt:"UUIDMost"`
-	Amount    float64 `nbt:"Amount"`
-	Operation int32   `nbt:"Operation"`
+	Name      string       `nbt:"Name"`
+	UUIDLeast int64        `nbt:"UUIDLeast"`
+	UUIDMost  int64        `nbt:"UUIDMost"`
+	Amount    float64      `nbt:"Amount"`
+	Operation int32        `nbt:"Operation"`
+	Unknown   nbt.Compound `nbt:",remain"`
 }
 
 // Attribute defines an active attribute for an entity.
 type Attribute struct {
-	Modifiers []Modifier `nbt:"Modifiers"`
-	Name      string     `nbt:"Name"`
-	Base      float64    `nbt:"Base"`
+	Modifiers []Modifier   `nbt:"Modifiers"`
+	Name      string       `nbt:"Name"`
+	Base      float64      `nbt:"Base"`
+	Unknown   nbt.Compound `nbt:",remain"`
 }
 
 // InventorySlot defines an inventory slot.
 type InventorySlot struct {
-	Id     string `nbt:"id"`
-	Damage int16  `nbt:"Damage"`
-	Count  int8   `nbt:"Count"`
-	Slot   int8   `nbt:"Slot"`
+	Id      string       `nbt:"id"`
+	Damage  int16        `nbt:"Damage"`
+	Count   int8         `nbt:"Count"`
+	Slot    int8         `nbt:"Slot"`
+	Unknown nbt.Compound `nbt:",remain"`
 }
 
 // Abilities describes entity abilities.
 type Abilities struct {
-	FlySpeed     float32 `nbt:"flySpeed"`
-	WalkSpeed    float32 `nbt:"walkSpeed"`
-	Flying       bool    `nbt:"flying"`
-	Instabuild   bool    `nbt:"instabuild"`
-	Invulnerable bool    `nbt:"invulnerable"`
-	Mayfly       bool    `nbt:"mayfly"`
-	MayBuild     bool    `nbt:"mayBuild"`
+	FlySpeed     float32      `nbt:"flySpeed"`
+	WalkSpeed    float32      `nbt:"walkSpeed"`
+	Flying       bool         `nbt:"flying"`
+	Instabuild   bool         `nbt:"instabuild"`
+	Invulnerable bool         `nbt:"invulnerable"`
+	Mayfly       bool         `nbt:"mayfly"`
+	MayBuild     bool         `nbt:"mayBuild"`
+	Unknown      nbt.Compound `nbt:",remain"`
 }
 
 type EntityTag struct {
-	CanDestroy  item.Id `nbt:"CanDestroy"`
-	Unbreakable bool    `nbt:"Damage"`
+	CanDestroy  item.Id      `nbt:"CanDestroy"`
+	Unbreakable bool         `nbt:"Damage"`
+	Unknown     nbt.Compound `nbt:",remain"`
 }
 
 // Items are used both in the player's inventory, Ender inventory,
@@ -55,26 +61,28 @@ type EntityTag struct {
 // such was with chests; other times there is no Slot tag, such as with
 // dropped items.
 type Item struct {
-	Tag    EntityTag `nbt:"tag"`
-	Id     string    `nbt:"id"`
-	Count  int8      `nbt:"Count"`
-	Slot   int8      `nbt:"Slot"`
-	Damage int8      `nbt:"Damage"`
+	Tag     EntityTag    `nbt:"tag"`
+	Id      string       `nbt:"id"`
+	Count   int8         `nbt:"Count"`
+	Slot    int8         `nbt:"Slot"`
+	Damage  int8         `nbt:"Damage"`
+	Unknown nbt.Compound `nbt:",remain"`
 }
 
 // CommandStats defines information identifying scoreboard parameters
 // to modify relative to the last command run.
 type CommandStats struct {
-	SuccessCountObjective     string `nbt:"SuccessCountObjective"`
-	SuccessCountName          string `nbt:"SuccessCountName"`
-	AffectedBlocksObjective   string `nbt:"AffectedBlocksObjective"`
-	AffectedBlocksName        string `nbt:"AffectedBlocksName"`
-	AffectedEntitiesObjective string `nbt:"AffectedEntitiesObjective"`
-	AffectedEntitiesName      string `nbt:"AffectedEntitiesName"`
-	AffectedItemsObjective    string `nbt:"AffectedItemsObjective"`
-	AffectedItemsName         string `nbt:"AffectedItemsName"`
-	QueryResultObjective      string `nbt:"QueryResultObjective"`
-	QueryResultName           string `nbt:"QueryResultName"`
+	SuccessCountObjective     string       `nbt:"SuccessCountObjective"`
+	SuccessCountName          string       `nbt:"SuccessCountName"`
+	AffectedBlocksObjective   string       `nbt:"AffectedBlocksObjective"`
+	AffectedBlocksName        string       `nbt:"AffectedBlocksName"`
+	AffectedEntitiesObjective string       `nbt:"AffectedEntitiesObjective"`
+	AffectedEntitiesName      string       `nbt:"AffectedEntitiesName"`
+	AffectedItemsObjective    string       `nbt:"AffectedItemsObjective"`
+	AffectedItemsName         string       `nbt:"AffectedItemsName"`
+	QueryResultObjective      string       `nbt:"QueryResultObjective"`
+	QueryResultName           string       `nbt:"QueryResultName"`
+	Unknown                   nbt.Compound `nbt:",remain"`
 }
 
 // TileEntity describes a tile entity.
@@ -100,13 +108,16 @@ type TileEntity struct {
 	MaxSpawnDelay       int16  `nbt:"MaxSpawnDelay"`
 	SpawnRange          int16  `nbt:"SpawnRange"`
 	SpawnCount          int16  `nbt:"SpawnCount"`
+
+	Unknown nbt.Compound `nbt:",remain"`
 }
 
 // Entity defines a single entity with fields shared by all entity types.
 //
-// FIXME: This listing is far from complete. There are a huge amount of
-// fields we do not account for here as they belong to individual entity
-// sub-types like Horses, chickens, etc.
+// This listing is far from complete. There are a huge amount of fields
+// we do not account for here as they belong to individual entity
+// sub-types like Horses, chickens, etc. These are kept in Unknown and
+// written back unchanged when the entity is saved.
 type Entity struct {
 	Riding            *Entity       `nbt:"Riding"`
 	CommandStats      *CommandStats `nbt:"CommandStats"`
@@ -131,4 +142,5 @@ type Entity struct {
 	Invulnerable      bool          `nbt:"Invulnerable"`
 	CustomNameVisible bool          `nbt:"CustomNameVisible"`
 	Silent            bool          `nbt:"Silent"`
+	Unknown           nbt.Compound  `nbt:",remain"`
 }
@@ -0,0 +1,42 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrChunkNotFound is returned when a chunk has not been generated yet.
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// ChunkError records a failed operation on a single chunk in a region,
+// along with its cause.
+type ChunkError struct {
+	RX, RZ int    // Region coordinates.
+	X, Z   int    // Chunk coordinates in the region.
+	Op     string // Operation which failed; e.g.: "read chunk".
+	Err    error  // Underlying error.
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("anvil: r(%d %d) c(%d %d): %s: %v",
+		e.RX, e.RZ, e.X, e.Z, e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// chunkError returns a ChunkError for the chunk at the given coordinates
+// in region r.
+func (r *Region) chunkError(x, z int, op string, err error) *ChunkError {
+	n := chunkIndex(x, z)
+	return &ChunkError{
+		RX: r.X, RZ: r.Z,
+		X: n % ChunksPerRegion, Z: n / ChunksPerRegion,
+		Op: op, Err: err,
+	}
+}
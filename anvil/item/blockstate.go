@@ -0,0 +1,458 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package item
+
+import "strings"
+
+// legacyStates maps block ids from before Minecraft 1.13 to the namespaced
+// block states which replaced them in 1.13 (the "flattening"). Names are
+// those used from Minecraft 1.14 onwards.
+//
+// Block states list their properties sorted by name. When several ids
+// share a block name, the first entry is used for states which are not
+// listed verbatim.
+//
+// Ref: https://minecraft.gamepedia.com/Java_Edition_data_values/Pre-flattening
+var legacyStates = []struct {
+	id    Id
+	state string
+}{
+	{Air, "minecraft:air"},
+	{Stone, "minecraft:stone"},
+	{Granite, "minecraft:granite"},
+	{GranitePolished, "minecraft:polished_granite"},
+	{Diorite, "minecraft:diorite"},
+	{DioritePolished, "minecraft:polished_diorite"},
+	{Andesite, "minecraft:andesite"},
+	{AndesitePolished, "minecraft:polished_andesite"},
+	{Grass, "minecraft:grass_block"},
+	{Dirt, "minecraft:dirt"},
+	{CoarseDirt, "minecraft:coarse_dirt"},
+	{Podzol, "minecraft:podzol"},
+	{Cobblestone, "minecraft:cobblestone"},
+	{OakPlanks, "minecraft:oak_planks"},
+	{SprucePlanks, "minecraft:spruce_planks"},
+	{BirchPlanks, "minecraft:birch_planks"},
+	{JunglePlanks, "minecraft:jungle_planks"},
+	{AcaciaPlanks, "minecraft:acacia_planks"},
+	{DarkOakPlanks, "minecraft:dark_oak_planks"},
+	{OakSapling, "minecraft:oak_sapling"},
+	{SpruceSapling, "minecraft:spruce_sapling"},
+	{BirchSapling, "minecraft:birch_sapling"},
+	{JungleSapling, "minecraft:jungle_sapling"},
+	{AcaciaSapling, "minecraft:acacia_sapling"},
+	{DarkOakSapling, "minecraft:dark_oak_sapling"},
+	{Bedrock, "minecraft:bedrock"},
+	{WaterNoSpread, "minecraft:water"},
+	{WaterFlowing, "minecraft:water[level=1]"},
+	{LavaNoSpread, "minecraft:lava"},
+	{LavaFlowing, "minecraft:lava[level=1]"},
+	{Sand, "minecraft:sand"},
+	{RedSand, "minecraft:red_sand"},
+	{Gravel, "minecraft:gravel"},
+	{GoldOre, "minecraft:gold_ore"},
+	{IronOre, "minecraft:iron_ore"},
+	{CoalOre, "minecraft:coal_ore"},
+	{OakLog, "minecraft:oak_log[axis=y]"},
+	{SpruceLog, "minecraft:spruce_log[axis=y]"},
+	{BirchLog, "minecraft:birch_log[axis=y]"},
+	{JungleLog, "minecraft:jungle_log[axis=y]"},
+	{Oak4Log, "minecraft:oak_log[axis=x]"},
+	{Oak5Log, "minecraft:spruce_log[axis=x]"},
+	{OakLeaves, "minecraft:oak_leaves"},
+	{SpruceLeaves, "minecraft:spruce_leaves"},
+	{BirchLeaves, "minecraft:birch_leaves"},
+	{JungleLeaves, "minecraft:jungle_leaves"},
+	{Sponge, "minecraft:sponge"},
+	{SpongeWet, "minecraft:wet_sponge"},
+	{Glass, "minecraft:glass"},
+	{LapisLazuliOre, "minecraft:lapis_ore"},
+	{LapisLazuliBlock, "minecraft:lapis_block"},
+	{Dispenser, "minecraft:dispenser"},
+	{Sandstone, "minecraft:sandstone"},
+	{SandstoneChiseled, "minecraft:chiseled_sandstone"},
+	{SandstoneSmooth, "minecraft:cut_sandstone"},
+	{NoteBlock, "minecraft:note_block"},
+	{BedBlock, "minecraft:red_bed"},
+	{RailPowered, "minecraft:powered_rail"},
+	{RailDetector, "minecraft:detector_rail"},
+	{StickyPiston, "minecraft:sticky_piston"},
+	{Cobweb, "minecraft:cobweb"},
+	{DeadShrub, "minecraft:dead_bush"},
+	{TallGrassDeadShrub, "minecraft:dead_bush"},
+	{TallGrass, "minecraft:grass"},
+	{TallGrassFern, "minecraft:fern"},
+	{Piston, "minecraft:piston"},
+	{PistonHead, "minecraft:piston_head"},
+	{WhiteWool, "minecraft:white_wool"},
+	{OrangeWool, "minecraft:orange_wool"},
+	{MagentaWool, "minecraft:magenta_wool"},
+	{LightBlueWool, "minecraft:light_blue_wool"},
+	{YellowWool, "minecraft:yellow_wool"},
+	{LimeWool, "minecraft:lime_wool"},
+	{PinkWool, "minecraft:pink_wool"},
+	{GrayWool, "minecraft:gray_wool"},
+	{LightGrayWool, "minecraft:light_gray_wool"},
+	{CyanWool, "minecraft:cyan_wool"},
+	{PurpleWool, "minecraft:purple_wool"},
+	{BlueWool, "minecraft:blue_wool"},
+	{BrownWool, "minecraft:brown_wool"},
+	{GreenWool, "minecraft:green_wool"},
+	{RedWool, "minecraft:red_wool"},
+	{BlackWool, "minecraft:black_wool"},
+	{PistonMoving, "minecraft:moving_piston"},
+	{Dandelion, "minecraft:dandelion"},
+	{Poppy, "minecraft:poppy"},
+	{BlueOrchid, "minecraft:blue_orchid"},
+	{Allium, "minecraft:allium"},
+	{AzureBluet, "minecraft:azure_bluet"},
+	{RedTulip, "minecraft:red_tulip"},
+	{OrangeTulip, "minecraft:orange_tulip"},
+	{WhiteTulip, "minecraft:white_tulip"},
+	{PinkTulip, "minecraft:pink_tulip"},
+	{OxeyeDaisy, "minecraft:oxeye_daisy"},
+	{MushroomBrown, "minecraft:brown_mushroom"},
+	{MushroomRed, "minecraft:red_mushroom"},
+	{GoldBlock, "minecraft:gold_block"},
+	{IronBlock, "minecraft:iron_block"},
+	{StoneSlab, "minecraft:smooth_stone_slab[type=bottom]"},
+	{SandstoneSlab, "minecraft:sandstone_slab[type=bottom]"},
+	{WoodSlab, "minecraft:petrified_oak_slab[type=bottom]"},
+	{CobblestoneSlab, "minecraft:cobblestone_slab[type=bottom]"},
+	{BrickSlab, "minecraft:brick_slab[type=bottom]"},
+	{StoneBrickSlab, "minecraft:stone_brick_slab[type=bottom]"},
+	{NetherBrickSlab, "minecraft:nether_brick_slab[type=bottom]"},
+	{QuartzSlab, "minecraft:quartz_slab[type=bottom]"},
+	{StoneDoubleSlab, "minecraft:smooth_stone_slab[type=double]"},
+	{SandstoneDoubleSlab, "minecraft:sandstone_slab[type=double]"},
+	{WoodDoubleSlab, "minecraft:petrified_oak_slab[type=double]"},
+	{CobblestoneDoubleSlab, "minecraft:cobblestone_slab[type=double]"},
+	{BrickDoubleSlab, "minecraft:brick_slab[type=double]"},
+	{StoneBrickDoubleSlab, "minecraft:stone_brick_slab[type=double]"},
+	{NetherBrickDoubleSlab, "minecraft:nether_brick_slab[type=double]"},
+	{QuartzDoubleSlab, "minecraft:quartz_slab[type=double]"},
+	{SmoothStoneDoubleSlab, "minecraft:smooth_stone"},
+	{SmoothSandstoneDoubleSlab, "minecraft:smooth_sandstone"},
+	{Brick, "minecraft:bricks"},
+	{TNT, "minecraft:tnt"},
+	{Bookshelf, "minecraft:bookshelf"},
+	{MossStone, "minecraft:mossy_cobblestone"},
+	{Obsidian, "minecraft:obsidian"},
+	{Torch, "minecraft:torch"},
+	{Fire, "minecraft:fire"},
+	{MobSpawner, "minecraft:spawner"},
+	{OakStairs, "minecraft:oak_stairs"},
+	{Chest, "minecraft:chest"},
+	{RedstoneWire, "minecraft:redstone_wire"},
+	{DiamondOre, "minecraft:diamond_ore"},
+	{DiamondBlock, "minecraft:diamond_block"},
+	{Workbench, "minecraft:crafting_table"},
+	{WheatCrop, "minecraft:wheat"},
+	{Farmland, "minecraft:farmland"},
+	{Furnace, "minecraft:furnace"},
+	{FurnaceSmelting, "minecraft:furnace[lit=true]"},
+	{SignBlock, "minecraft:oak_sign"},
+	{OakDoorBlock, "minecraft:oak_door"},
+	{Ladder, "minecraft:ladder"},
+	{Rail, "minecraft:rail"},
+	{CobblestoneStairs, "minecraft:cobblestone_stairs"},
+	{Signwall, "minecraft:oak_wall_sign"},
+	{Lever, "minecraft:lever"},
+	{StonePressurePlate, "minecraft:stone_pressure_plate"},
+	{IronDoorBlock, "minecraft:iron_door"},
+	{WoodPressurePlate, "minecraft:oak_pressure_plate"},
+	{RedstoneOre, "minecraft:redstone_ore"},
+	{RedstoneOreGlowing, "minecraft:redstone_ore[lit=true]"},
+	{RedstoneTorch, "minecraft:redstone_torch"},
+	{RedstoneTorchOff, "minecraft:redstone_torch[lit=false]"},
+	{StoneButton, "minecraft:stone_button"},
+	{Snow, "minecraft:snow"},
+	{Ice, "minecraft:ice"},
+	{SnowBlock, "minecraft:snow_block"},
+	{Cactus, "minecraft:cactus"},
+	{ClayBlock, "minecraft:clay"},
+	{SugarcaneBlock, "minecraft:sugar_cane"},
+	{Jukebox, "minecraft:jukebox"},
+	{OakFence, "minecraft:oak_fence"},
+	{Pumpkin, "minecraft:carved_pumpkin"},
+	{Netherrack, "minecraft:netherrack"},
+	{SoulSand, "minecraft:soul_sand"},
+	{Glowstone, "minecraft:glowstone"},
+	{Portal, "minecraft:nether_portal"},
+	{JackOLantern, "minecraft:jack_o_lantern"},
+	{CakeBlock, "minecraft:cake"},
+	{RedstoneRepeaterBlockOff, "minecraft:repeater"},
+	{RedstoneRepeaterBlockOn, "minecraft:repeater[powered=true]"},
+	{WhiteStainedGlass, "minecraft:white_stained_glass"},
+	{OrangeStainedGlass, "minecraft:orange_stained_glass"},
+	{MagentaStainedGlass, "minecraft:magenta_stained_glass"},
+	{LightBlueStainedGlass, "minecraft:light_blue_stained_glass"},
+	{YellowStainedGlass, "minecraft:yellow_stained_glass"},
+	{LimeStainedGlass, "minecraft:lime_stained_glass"},
+	{PinkStainedGlass, "minecraft:pink_stained_glass"},
+	{GrayStainedGlass, "minecraft:gray_stained_glass"},
+	{LightGrayStainedGlass, "minecraft:light_gray_stained_glass"},
+	{CyanStainedGlass, "minecraft:cyan_stained_glass"},
+	{PurpleStainedGlass, "minecraft:purple_stained_glass"},
+	{BlueStainedGlass, "minecraft:blue_stained_glass"},
+	{BrownStainedGlass, "minecraft:brown_stained_glass"},
+	{GreenStainedGlass, "minecraft:green_stained_glass"},
+	{RedStainedGlass, "minecraft:red_stained_glass"},
+	{BlackStainedGlass, "minecraft:black_stained_glass"},
+	{WoodTrapdoor, "minecraft:oak_trapdoor"},
+	{MonsterEggStone, "minecraft:infested_stone"},
+	{MonsterEggCobblestone, "minecraft:infested_cobblestone"},
+	{MonsterEggStoneBrick, "minecraft:infested_stone_bricks"},
+	{MonsterEggMossyStoneBrick, "minecraft:infested_mossy_stone_bricks"},
+	{MonsterEggCrackedStone, "minecraft:infested_cracked_stone_bricks"},
+	{MonsterEggChiseledStone, "minecraft:infested_chiseled_stone_bricks"},
+	{StoneBrick, "minecraft:stone_bricks"},
+	{StoneBrickMossy, "minecraft:mossy_stone_bricks"},
+	{StoneBrickCracked, "minecraft:cracked_stone_bricks"},
+	{StoneBrickChiseled, "minecraft:chiseled_stone_bricks"},
+	{MushroomBrownBlock, "minecraft:brown_mushroom_block"},
+	{MushroomRedBlock, "minecraft:red_mushroom_block"},
+	{IronBars, "minecraft:iron_bars"},
+	{GlassPane, "minecraft:glass_pane"},
+	{MelonBlock, "minecraft:melon"},
+	{PumpkinVine, "minecraft:pumpkin_stem"},
+	{MelonVine, "minecraft:melon_stem"},
+	{Vines, "minecraft:vine"},
+	{OakFenceGate, "minecraft:oak_fence_gate"},
+	{BrickStairs, "minecraft:brick_stairs"},
+	{StoneBrickStairs, "minecraft:stone_brick_stairs"},
+	{Mycelium, "minecraft:mycelium"},
+	{LilyPad, "minecraft:lily_pad"},
+	{NetherBrickBlock, "minecraft:nether_bricks"},
+	{NetherBrickFence, "minecraft:nether_brick_fence"},
+	{NetherBrickStairs, "minecraft:nether_brick_stairs"},
+	{NetherWart, "minecraft:nether_wart"},
+	{EnchantmentTable, "minecraft:enchanting_table"},
+	{BrewingStandBlock, "minecraft:brewing_stand"},
+	{CauldronBlock, "minecraft:cauldron"},
+	{EndPortal, "minecraft:end_portal"},
+	{EndPortalFrame, "minecraft:end_portal_frame"},
+	{EndStone, "minecraft:end_stone"},
+	{DragonEgg, "minecraft:dragon_egg"},
+	{RedstoneLamp, "minecraft:redstone_lamp"},
+	{RedstoneLampOn, "minecraft:redstone_lamp[lit=true]"},
+	{OakSlab, "minecraft:oak_slab[type=bottom]"},
+	{SpruceSlab, "minecraft:spruce_slab[type=bottom]"},
+	{BirchSlab, "minecraft:birch_slab[type=bottom]"},
+	{JungleSlab, "minecraft:jungle_slab[type=bottom]"},
+	{AcaciaSlab, "minecraft:acacia_slab[type=bottom]"},
+	{DarkOakSlab, "minecraft:dark_oak_slab[type=bottom]"},
+	{OakDoubleSlab, "minecraft:oak_slab[type=double]"},
+	{SpruceDoubleSlab, "minecraft:spruce_slab[type=double]"},
+	{BirchDoubleSlab, "minecraft:birch_slab[type=double]"},
+	{JungleDoubleSlab, "minecraft:jungle_slab[type=double]"},
+	{AcaciaDoubleSlab, "minecraft:acacia_slab[type=double]"},
+	{DarkOakDoubleSlab, "minecraft:dark_oak_slab[type=double]"},
+	{CocoaPlant, "minecraft:cocoa"},
+	{SandstoneStairs, "minecraft:sandstone_stairs"},
+	{EmeraldOre, "minecraft:emerald_ore"},
+	{EnderChest, "minecraft:ender_chest"},
+	{TripwireHook, "minecraft:tripwire_hook"},
+	{Tripwire, "minecraft:tripwire"},
+	{EmeraldBlock, "minecraft:emerald_block"},
+	{SpruceStairs, "minecraft:spruce_stairs"},
+	{BirchStairs, "minecraft:birch_stairs"},
+	{JungleStairs, "minecraft:jungle_stairs"},
+	{CommandBlock, "minecraft:command_block"},
+	{Beacon, "minecraft:beacon"},
+	{CobblestoneWall, "minecraft:cobblestone_wall"},
+	{MossyCobblestoneWall, "minecraft:mossy_cobblestone_wall"},
+	{FlowerPotBlock, "minecraft:flower_pot"},
+	{CarrotCrop, "minecraft:carrots"},
+	{PotatoCrop, "minecraft:potatoes"},
+	{WoodButton, "minecraft:oak_button"},
+	{HeadBlockSkeleton, "minecraft:skeleton_skull"},
+	{HeadBlockWither, "minecraft:wither_skeleton_skull"},
+	{HeadBlockZombie, "minecraft:zombie_head"},
+	{HeadBlockSteve, "minecraft:player_head"},
+	{HeadBlockCreeper, "minecraft:creeper_head"},
+	{Anvil, "minecraft:anvil"},
+	{AnvilSlightlyDamaged, "minecraft:chipped_anvil"},
+	{AnvilVeryDamaged, "minecraft:damaged_anvil"},
+	{TrappedChest, "minecraft:trapped_chest"},
+	{WeightedPressurePlateLight, "minecraft:light_weighted_pressure_plate"},
+	{WeightedPressurePlateHeavy, "minecraft:heavy_weighted_pressure_plate"},
+	{RedstoneComparatorOff, "minecraft:comparator"},
+	{RedstoneComparatorOn, "minecraft:comparator[powered=true]"},
+	{DaylightSensor, "minecraft:daylight_detector"},
+	{DaylightSensorInverted, "minecraft:daylight_detector[inverted=true]"},
+	{RedstoneBlock, "minecraft:redstone_block"},
+	{NetherQuartzOre, "minecraft:nether_quartz_ore"},
+	{Hopper, "minecraft:hopper"},
+	{QuartzBlock, "minecraft:quartz_block"},
+	{QuartzBlockChiseled, "minecraft:chiseled_quartz_block"},
+	{QuartzBlockPillar, "minecraft:quartz_pillar[axis=y]"},
+	{QuartzStairs, "minecraft:quartz_stairs"},
+	{RailActivator, "minecraft:activator_rail"},
+	{Dropper, "minecraft:dropper"},
+	{WhiteStainedClay, "minecraft:white_terracotta"},
+	{OrangeStainedClay, "minecraft:orange_terracotta"},
+	{MagentaStainedClay, "minecraft:magenta_terracotta"},
+	{LightBlueStainedClay, "minecraft:light_blue_terracotta"},
+	{YellowStainedClay, "minecraft:yellow_terracotta"},
+	{LimeStainedClay, "minecraft:lime_terracotta"},
+	{PinkStainedClay, "minecraft:pink_terracotta"},
+	{GrayStainedClay, "minecraft:gray_terracotta"},
+	{LightGrayStainedClay, "minecraft:light_gray_terracotta"},
+	{CyanStainedClay, "minecraft:cyan_terracotta"},
+	{PurpleStainedClay, "minecraft:purple_terracotta"},
+	{BlueStainedClay, "minecraft:blue_terracotta"},
+	{BrownStainedClay, "minecraft:brown_terracotta"},
+	{GreenStainedClay, "minecraft:green_terracotta"},
+	{RedStainedClay, "minecraft:red_terracotta"},
+	{BlackStainedClay, "minecraft:black_terracotta"},
+	{WhiteStainedGlassPane, "minecraft:white_stained_glass_pane"},
+	{OrangeStainedGlassPane, "minecraft:orange_stained_glass_pane"},
+	{MagentaStainedGlassPane, "minecraft:magenta_stained_glass_pane"},
+	{LightBlueStainedGlassPane, "minecraft:light_blue_stained_glass_pane"},
+	{YellowStainedGlassPane, "minecraft:yellow_stained_glass_pane"},
+	{LimeStainedGlassPane, "minecraft:lime_stained_glass_pane"},
+	{PinkStainedGlassPane, "minecraft:pink_stained_glass_pane"},
+	{GrayStainedGlassPane, "minecraft:gray_stained_glass_pane"},
+	{LightGrayStainedGlassPane, "minecraft:light_gray_stained_glass_pane"},
+	{CyanStainedGlassPane, "minecraft:cyan_stained_glass_pane"},
+	{PurpleStainedGlassPane, "minecraft:purple_stained_glass_pane"},
+	{BlueStainedGlassPane, "minecraft:blue_stained_glass_pane"},
+	{BrownStainedGlassPane, "minecraft:brown_stained_glass_pane"},
+	{GreenStainedGlassPane, "minecraft:green_stained_glass_pane"},
+	{RedStainedGlassPane, "minecraft:red_stained_glass_pane"},
+	{BlackStainedGlassPane, "minecraft:black_stained_glass_pane"},
+	{AcaciaLeaves, "minecraft:acacia_leaves"},
+	{DarkOakLeaves, "minecraft:dark_oak_leaves"},
+	{AcaciaLog, "minecraft:acacia_log[axis=y]"},
+	{DarkOakLog, "minecraft:dark_oak_log[axis=y]"},
+	{AcaciaStairs, "minecraft:acacia_stairs"},
+	{DarkOakStairs, "minecraft:dark_oak_stairs"},
+	{SlimeBlock, "minecraft:slime_block"},
+	{Barrier, "minecraft:barrier"},
+	{IronTrapdoor, "minecraft:iron_trapdoor"},
+	{Prismarine, "minecraft:prismarine"},
+	{PrismarineBricks, "minecraft:prismarine_bricks"},
+	{PrismarineDark, "minecraft:dark_prismarine"},
+	{SeaLantern, "minecraft:sea_lantern"},
+	{HayBale, "minecraft:hay_block[axis=y]"},
+	{WhiteCarpet, "minecraft:white_carpet"},
+	{OrangeCarpet, "minecraft:orange_carpet"},
+	{MagentaCarpet, "minecraft:magenta_carpet"},
+	{LightBlueCarpet, "minecraft:light_blue_carpet"},
+	{YellowCarpet, "minecraft:yellow_carpet"},
+	{LimeCarpet, "minecraft:lime_carpet"},
+	{PinkCarpet, "minecraft:pink_carpet"},
+	{GrayCarpet, "minecraft:gray_carpet"},
+	{LightGrayCarpet, "minecraft:light_gray_carpet"},
+	{CyanCarpet, "minecraft:cyan_carpet"},
+	{PurpleCarpet, "minecraft:purple_carpet"},
+	{BlueCarpet, "minecraft:blue_carpet"},
+	{BrownCarpet, "minecraft:brown_carpet"},
+	{GreenCarpet, "minecraft:green_carpet"},
+	{RedCarpet, "minecraft:red_carpet"},
+	{BlackCarpet, "minecraft:black_carpet"},
+	{HardenedClay, "minecraft:terracotta"},
+	{CoalBlock, "minecraft:coal_block"},
+	{PackedIce, "minecraft:packed_ice"},
+	{Sunflower, "minecraft:sunflower[half=lower]"},
+	{Lilac, "minecraft:lilac[half=lower]"},
+	{DoubleTallgrass, "minecraft:tall_grass[half=lower]"},
+	{LargeFern, "minecraft:large_fern[half=lower]"},
+	{Rosebush, "minecraft:rose_bush[half=lower]"},
+	{Peony, "minecraft:peony[half=lower]"},
+	{BannerStandingBlock, "minecraft:white_banner"},
+	{BannerWallBlock, "minecraft:white_wall_banner"},
+	{RedSandstone, "minecraft:red_sandstone"},
+	{RedSandstoneChiseled, "minecraft:chiseled_red_sandstone"},
+	{RedSandstoneSmooth, "minecraft:cut_red_sandstone"},
+	{RedSandstoneStairs, "minecraft:red_sandstone_stairs"},
+	{RedSandstoneSlab, "minecraft:red_sandstone_slab[type=bottom]"},
+	{RedSandstoneDoubleSlab, "minecraft:red_sandstone_slab[type=double]"},
+	{SpruceFenceGate, "minecraft:spruce_fence_gate"},
+	{BirchFenceGate, "minecraft:birch_fence_gate"},
+	{JungleFenceGate, "minecraft:jungle_fence_gate"},
+	{DarkOakFenceGate, "minecraft:dark_oak_fence_gate"},
+	{AcaciaFenceGate, "minecraft:acacia_fence_gate"},
+	{SpruceFence, "minecraft:spruce_fence"},
+	{BirchFence, "minecraft:birch_fence"},
+	{JungleFence, "minecraft:jungle_fence"},
+	{DarkOakFence, "minecraft:dark_oak_fence"},
+	{AcaciaFence, "minecraft:acacia_fence"},
+	{SpruceDoorBlock, "minecraft:spruce_door"},
+	{BirchDoorBlock, "minecraft:birch_door"},
+	{JungleDoorBlock, "minecraft:jungle_door"},
+	{AcaciaDoorBlock, "minecraft:acacia_door"},
+	{DarkOakDoorBlock, "minecraft:dark_oak_door"},
+}
+
+var (
+	stateById map[Id]string // Block state for each legacy id.
+	idByState map[string]Id // Legacy id for each block state.
+	idByName  map[string]Id // Legacy id for each block name, sans properties.
+)
+
+func init() {
+	stateById = make(map[Id]string, len(legacyStates))
+	idByState = make(map[string]Id, len(legacyStates))
+	idByName = make(map[string]Id, len(legacyStates))
+
+	for _, v := range legacyStates {
+		if _, ok := stateById[v.id]; !ok {
+			stateById[v.id] = v.state
+		}
+
+		if _, ok := idByState[v.state]; !ok {
+			idByState[v.state] = v.id
+		}
+
+		name := stateName(v.state)
+		if _, ok := idByName[name]; !ok {
+			idByName[name] = v.id
+		}
+	}
+}
+
+// BlockState returns the namespaced block state which replaced this
+// id in Minecraft 1.13. E.g.: minecraft:oak_log[axis=y]
+//
+// Sub-ids which denote orientation or other block data, rather than a
+// distinct block type, yield the state for the primary id.
+// Returns false if the id is not a known block.
+func (id Id) BlockState() (string, bool) {
+	if state, ok := stateById[id]; ok {
+		return state, true
+	}
+
+	state, ok := stateById[id&idMask]
+	return state, ok
+}
+
+// FromBlockState returns the pre-1.13 id for the given block state.
+// The state is expected in the form namespace:name[key=value,...], with
+// properties sorted by name. The namespace defaults to "minecraft".
+//
+// States without a direct equivalent map to the id for the block name,
+// ignoring the properties. Returns false if the block is not known.
+func FromBlockState(state string) (Id, bool) {
+	if !strings.Contains(stateName(state), ":") {
+		state = "minecraft:" + state
+	}
+
+	if id, ok := idByState[state]; ok {
+		return id, true
+	}
+
+	id, ok := idByName[stateName(state)]
+	return id, ok
+}
+
+// stateName returns the block name from the given block state, minus
+// its properties.
+func stateName(state string) string {
+	if n := strings.IndexByte(state, '['); n > -1 {
+		return state[:n]
+	}
+	return state
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
@@ -26,7 +27,16 @@ const (
 // Refer to item.go for a complete listing of known item ids.
 type Id uint32
 
+// Unknown is the id given to blocks which have no pre-1.13 equivalent,
+// like blocks added in later versions of Minecraft or by mods. It is
+// distinct from Air and from all known ids.
+const Unknown Id = idMask
+
 func (i Id) String() string {
+	if i == Unknown {
+		return "Unknown"
+	}
+
 	if str, ok := _Id_map[i]; ok {
 		return str
 	}
@@ -104,3 +114,27 @@ func (id Id) Primary() int { return int(id & idMask) }
 
 // Sub returns the sub id component.
 func (id Id) Sub() int { return int(id>>idBits) & idMask }
+
+var (
+	byNameOnce sync.Once
+	byName     map[string]Id
+)
+
+// Lookup returns the id with the given name, as yielded by Id.String.
+// Names are matched without regard to case. If several ids share a name,
+// the lowest id is returned. Returns false if the name is not known.
+func Lookup(name string) (Id, bool) {
+	byNameOnce.Do(func() {
+		byName = make(map[string]Id, len(_Id_map))
+
+		for id, str := range _Id_map {
+			key := strings.ToLower(str)
+			if old, ok := byName[key]; !ok || id < old {
+				byName[key] = id
+			}
+		}
+	})
+
+	id, ok := byName[strings.ToLower(name)]
+	return id, ok
+}
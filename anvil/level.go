@@ -36,63 +36,77 @@ const (
 
 // GameRules describes the current rules for a world.
 type GameRules struct {
-	RandomTickSpeed     string `nbt:"randomTickSpeed"`
-	CommandBlockOutput  bool   `nbt:"commandBlockOutput"`
-	DaylightCycle       bool   `nbt:"doDaylightCycle"`
-	FireTick            bool   `nbt:"doFireTick"`
-	TileDrops           bool   `nbt:"doTileDrops"`
-	KeepInventory       bool   `nbt:"keepInventory"`
-	LogAdminCommands    bool   `nbt:"logAdminCommands"`
-	MobLoot             bool   `nbt:"doMobLoot"`
-	MobSpawning         bool   `nbt:"doMobSpawning"`
-	MobGriefing         bool   `nbt:"mobGriefing"`
-	NaturalRegeneration bool   `nbt:"naturalRegeneration"`
-	SendCommandFeedback bool   `nbt:"sendCommandFeedback"`
-	ShowDeathMessages   bool   `nbt:"showDeathMessages"`
-	ReducedDebugInfo    bool   `nbt:"reducedDebugInfo"`
-	EntityDrops         bool   `nbt:"doEntityDrops"`
+	RandomTickSpeed     string       `nbt:"randomTickSpeed"`
+	CommandBlockOutput  bool         `nbt:"commandBlockOutput"`
+	DaylightCycle       bool         `nbt:"doDaylightCycle"`
+	FireTick            bool         `nbt:"doFireTick"`
+	TileDrops           bool         `nbt:"doTileDrops"`
+	KeepInventory       bool         `nbt:"keepInventory"`
+	LogAdminCommands    bool         `nbt:"logAdminCommands"`
+	MobLoot             bool         `nbt:"doMobLoot"`
+	MobSpawning         bool         `nbt:"doMobSpawning"`
+	MobGriefing         bool         `nbt:"mobGriefing"`
+	NaturalRegeneration bool         `nbt:"naturalRegeneration"`
+	SendCommandFeedback bool         `nbt:"sendCommandFeedback"`
+	ShowDeathMessages   bool         `nbt:"showDeathMessages"`
+	ReducedDebugInfo    bool         `nbt:"reducedDebugInfo"`
+	EntityDrops         bool         `nbt:"doEntityDrops"`
+	Unknown             nbt.Compound `nbt:",remain"`
 }
 
 // Level describes the level.dat file for a Minecraft world.
 // It holds general information about a world, like the name,
 // the generator and seed and other things.
+//
+// Tags not covered by the fields below are kept in Unknown and written
+// back unchanged when the level is saved. The same goes for tags outside
+// the Data compound.
 type Level struct {
-	Player               *Player    `nbt:"Player"`
-	Rules                GameRules  `nbt:"GameRules"`
-	Name                 string     `nbt:"LevelName"`
-	GeneratorName        string     `nbt:"generatorName"`
-	GeneratorOptions     string     `nbt:"generatorOptions"`
-	LastPlayed           int64      `nbt:"LastPlayed"`
-	Seed                 int64      `nbt:"RandomSeed"`
-	Time                 int64      `nbt:"Time"`
-	DayTime              int64      `nbt:"DayTime"`
-	SizeOnDisk           int64      `nbt:"SizeOnDisk"`
-	BorderSizeLerpTime   int64      `nbt:"BorderSizeLerpTime"`
-	BorderCenterX        float64    `nbt:"BorderCenterX"`
-	BorderCenterZ        float64    `nbt:"BorderCenterZ"`
-	BorderSize           float64    `nbt:"BorderSize"`
-	BorderSizeLerpTarget float64    `nbt:"BorderSizeLerpTarget"`
-	BorderWarningBlocks  float64    `nbt:"BorderWarningBlocks"`
-	BorderWarningTime    float64    `nbt:"BorderWarningTime"`
-	BorderDamagePerBlock float64    `nbt:"BorderDamagePerBlock"`
-	BorderSafeZone       float64    `nbt:"BorderSafeZone"`
-	GeneratorVersion     int32      `nbt:"generatorVersion"`
-	Version              int32      `nbt:"version"`
-	SpawnX               int32      `nbt:"SpawnX"`
-	SpawnY               int32      `nbt:"SpawnY"`
-	SpawnZ               int32      `nbt:"SpawnZ"`
-	RainTime             int32      `nbt:"rainTime"`
-	ClearWeatherTime     int32      `nbt:"clearWeatherTime"`
-	ThunderTime          int32      `nbt:"thunderTime"`
-	GameMode             GameMode   `nbt:"GameType"`
-	Difficulty           Difficulty `nbt:"Difficulty"`
-	Initialized          bool       `nbt:"initialized"`
-	MapFeatures          bool       `nbt:"MapFeatures"`
-	AllowCommands        bool       `nbt:"allowCommands"`
-	Hardcore             bool       `nbt:"hardcore"`
-	DifficultyLocked     bool       `nbt:"DifficultyLocked"`
-	Raining              bool       `nbt:"raining"`
-	Thundering           bool       `nbt:"thundering"`
+	Player               *Player      `nbt:"Player"`
+	Rules                GameRules    `nbt:"GameRules"`
+	Name                 string       `nbt:"LevelName"`
+	GeneratorName        string       `nbt:"generatorName"`
+	GeneratorOptions     string       `nbt:"generatorOptions"`
+	LastPlayed           int64        `nbt:"LastPlayed"`
+	Seed                 int64        `nbt:"RandomSeed"`
+	Time                 int64        `nbt:"Time"`
+	DayTime              int64        `nbt:"DayTime"`
+	SizeOnDisk           int64        `nbt:"SizeOnDisk"`
+	BorderSizeLerpTime   int64        `nbt:"BorderSizeLerpTime"`
+	BorderCenterX        float64      `nbt:"BorderCenterX"`
+	BorderCenterZ        float64      `nbt:"BorderCenterZ"`
+	BorderSize           float64      `nbt:"BorderSize"`
+	BorderSizeLerpTarget float64      `nbt:"BorderSizeLerpTarget"`
+	BorderWarningBlocks  float64      `nbt:"BorderWarningBlocks"`
+	BorderWarningTime    float64      `nbt:"BorderWarningTime"`
+	BorderDamagePerBlock float64      `nbt:"BorderDamagePerBlock"`
+	BorderSafeZone       float64      `nbt:"BorderSafeZone"`
+	GeneratorVersion     int32        `nbt:"generatorVersion"`
+	Version              int32        `nbt:"version"`
+	SpawnX               int32        `nbt:"SpawnX"`
+	SpawnY               int32        `nbt:"SpawnY"`
+	SpawnZ               int32        `nbt:"SpawnZ"`
+	RainTime             int32        `nbt:"rainTime"`
+	ClearWeatherTime     int32        `nbt:"clearWeatherTime"`
+	ThunderTime          int32        `nbt:"thunderTime"`
+	GameMode             GameMode     `nbt:"GameType"`
+	Difficulty           Difficulty   `nbt:"Difficulty"`
+	Initialized          bool         `nbt:"initialized"`
+	MapFeatures          bool         `nbt:"MapFeatures"`
+	AllowCommands        bool         `nbt:"allowCommands"`
+	Hardcore             bool         `nbt:"hardcore"`
+	DifficultyLocked     bool         `nbt:"DifficultyLocked"`
+	Raining              bool         `nbt:"raining"`
+	Thundering           bool         `nbt:"thundering"`
+	Unknown              nbt.Compound `nbt:",remain"`
+
+	root nbt.Compound // Unknown tags outside the Data compound.
+}
+
+// levelRoot defines the root compound of a level.dat file.
+type levelRoot struct {
+	Data    *Level
+	Unknown nbt.Compound `nbt:",remain"`
 }
 
 // LoadLevel loads level data from the given level.dat file.
@@ -111,35 +125,46 @@ func LoadLevel(file string) (*Level, error) {
 
 	defer gz.Close()
 
-	var v struct {
-		Data Level
-	}
+	var v levelRoot
+	v.Data = new(Level)
 
 	err = nbt.Unmarshal(gz, &v)
 	if err != nil {
 		return nil, err
 	}
 
-	return &v.Data, nil
+	v.Data.root = v.Unknown
+	return v.Data, nil
 }
 
 // Save saves level data to the given file.
+//
+// The data is written to a temporary file first, which then replaces the
+// original. The original is left intact if saving fails.
 func (l *Level) Save(file string) error {
-	fd, err := os.Create(file)
-	if err != nil {
-		return err
-	}
+	return writeFile(file, "", l.write)
+}
 
-	defer fd.Close()
+// SaveWithBackup saves level data to the given file, like Save. The
+// previous version of the file is kept with LevelBackupSuffix appended
+// to its name, as Minecraft does with level.dat_old.
+func (l *Level) SaveWithBackup(file string) error {
+	return writeFile(file, file+LevelBackupSuffix, l.write)
+}
 
-	var v struct {
-		Data *Level
+// write writes the compressed level data to w.
+func (l *Level) write(w *os.File) error {
+	v := levelRoot{
+		Data:    l,
+		Unknown: l.root,
 	}
 
-	v.Data = l
+	gz := gzip.NewWriter(w)
+	err := nbt.Marshal(gz, v)
+
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
 
-	gz := gzip.NewWriter(fd)
-	err = nbt.Marshal(gz, v)
-	gz.Close()
 	return err
 }
@@ -4,8 +4,11 @@
 package anvil
 
 import (
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/kpfaulkner/mctools/anvil/nbt"
 )
 
 func TestLevelRoundtrip(t *testing.T) {
@@ -17,6 +20,9 @@ func TestLevelRoundtrip(t *testing.T) {
 		t.Fatalf("Load 1: %v", err)
 	}
 
+	// Tags outside the Data compound must survive a save.
+	la.root.Set("ForgeData", nbt.Compound{{Name: "minecraft", Value: int32(1343)}})
+
 	err = la.Save(File2)
 	if err != nil {
 		t.Fatalf("Save 2: %v", err)
@@ -31,3 +37,45 @@ func TestLevelRoundtrip(t *testing.T) {
 		t.Fatalf("roundtrip mismatch:\nHave: %+v\nWant: %+v", lb, la)
 	}
 }
+
+func TestLevelBackup(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "level.dat")
+
+	l, err := LoadLevel("../testdata/newworld/level.dat")
+	if err != nil {
+		t.Fatalf("Load 1: %v", err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		l.Name = name
+
+		if err = l.SaveWithBackup(file); err != nil {
+			t.Fatalf("Save %s: %v", name, err)
+		}
+	}
+
+	for file, want := range map[string]string{
+		file:                     "second",
+		file + LevelBackupSuffix: "first",
+	} {
+		l, err = LoadLevel(file)
+		if err != nil {
+			t.Fatalf("Load %s: %v", file, err)
+		}
+
+		if l.Name != want {
+			t.Fatalf("%s: name mismatch: have %q, want %q", file, l.Name, want)
+		}
+	}
+
+	// No temporary files should be left behind.
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 2 {
+		t.Fatalf("unexpected files: %v", names)
+	}
+}
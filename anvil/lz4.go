@@ -0,0 +1,340 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// LZ4 compressed chunks use the stream format of the lz4-java library,
+// which Minecraft relies on. The data is split into blocks, each prefixed
+// with a header:
+//
+//	magic      [8]byte  "LZ4Block"
+//	token      uint8    Method (high nibble) and block size (low nibble).
+//	compressed uint32   Compressed size of the block (little endian).
+//	original   uint32   Uncompressed size of the block (little endian).
+//	checksum   uint32   XXH32 of the uncompressed data (little endian).
+//
+// The stream ends with an empty block.
+const (
+	lz4Magic      = "LZ4Block"
+	lz4HeaderSize = len(lz4Magic) + 13
+	lz4MethodRaw  = 0x10
+	lz4MethodLZ4  = 0x20
+	lz4BlockLevel = 6 // Blocks of 1<<(10+6) = 64KiB; the lz4-java default.
+	lz4Seed       = 0x9747b28c
+
+	lz4MinMatch     = 4
+	lz4LastLiterals = 5  // Number of bytes at the end which must be literals.
+	lz4MatchLimit   = 12 // Matches must start this far from the end.
+	lz4MaxOffset    = 0xffff
+	lz4HashBits     = 12
+)
+
+var errLZ4Corrupt = errors.New("lz4: corrupt input")
+
+// lz4Encode compresses data into an lz4-java block stream.
+func lz4Encode(data []byte) []byte {
+	const blockSize = 1 << (10 + lz4BlockLevel)
+
+	var out []byte
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+
+		block := data[:n]
+		data = data[n:]
+
+		method := byte(lz4MethodLZ4)
+		packed := lz4CompressBlock(block)
+
+		if len(packed) >= len(block) {
+			method, packed = lz4MethodRaw, block
+		}
+
+		out = lz4AppendHeader(out, method, len(packed), len(block), lz4Checksum(block))
+		out = append(out, packed...)
+	}
+
+	return lz4AppendHeader(out, lz4MethodRaw, 0, 0, 0)
+}
+
+// lz4Decode decompresses an lz4-java block stream.
+func lz4Decode(data []byte) ([]byte, error) {
+	var out []byte
+
+	for {
+		if len(data) < lz4HeaderSize || !bytes.HasPrefix(data, []byte(lz4Magic)) {
+			return nil, errLZ4Corrupt
+		}
+
+		h := data[len(lz4Magic):]
+		token := h[0]
+		packed := int(binary.LittleEndian.Uint32(h[1:]))
+		size := int(binary.LittleEndian.Uint32(h[5:]))
+		check := binary.LittleEndian.Uint32(h[9:])
+		data = data[lz4HeaderSize:]
+
+		blockSize := 1 << (10 + token&0xf)
+		if size > blockSize || packed < 0 || packed > len(data) {
+			return nil, errLZ4Corrupt
+		}
+
+		if size == 0 {
+			return out, nil
+		}
+
+		block := make([]byte, size)
+
+		switch token & 0xf0 {
+		case lz4MethodRaw:
+			if packed != size {
+				return nil, errLZ4Corrupt
+			}
+			copy(block, data)
+		case lz4MethodLZ4:
+			if err := lz4DecompressBlock(block, data[:packed]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errLZ4Corrupt
+		}
+
+		if lz4Checksum(block) != check {
+			return nil, errors.New("lz4: checksum mismatch")
+		}
+
+		out = append(out, block...)
+		data = data[packed:]
+	}
+}
+
+// lz4AppendHeader appends a block header to b.
+func lz4AppendHeader(b []byte, method byte, packed, size int, check uint32) []byte {
+	var h [13]byte
+	h[0] = method | lz4BlockLevel
+	binary.LittleEndian.PutUint32(h[1:], uint32(packed))
+	binary.LittleEndian.PutUint32(h[5:], uint32(size))
+	binary.LittleEndian.PutUint32(h[9:], check)
+
+	b = append(b, lz4Magic...)
+	return append(b, h[:]...)
+}
+
+// lz4Checksum returns the block checksum as computed by lz4-java, which
+// only keeps the lower 28 bits of the hash.
+func lz4Checksum(b []byte) uint32 {
+	return xxh32(b, lz4Seed) & 0xfffffff
+}
+
+// lz4CompressBlock compresses src into a single raw LZ4 block, using a
+// simple greedy match finder.
+func lz4CompressBlock(src []byte) []byte {
+	var table [1 << lz4HashBits]int // Positions + 1 of recent 4-byte sequences.
+
+	dst := make([]byte, 0, len(src)+len(src)/255+16)
+	anchor := 0
+
+	for i := 0; i+lz4MatchLimit < len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := (v * 2654435761) >> (32 - lz4HashBits)
+		ref := table[h] - 1
+		table[h] = i + 1
+
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != v {
+			i++
+			continue
+		}
+
+		n := lz4MinMatch
+		for i+n < len(src)-lz4LastLiterals && src[ref+n] == src[i+n] {
+			n++
+		}
+
+		dst = lz4AppendSequence(dst, src[anchor:i], i-ref, n)
+		i += n
+		anchor = i
+	}
+
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4AppendSequence appends the given literals, followed by a match of
+// length n at the given offset, to dst. A zero length omits the match;
+// this is used for the final sequence.
+func lz4AppendSequence(dst, literals []byte, offset, n int) []byte {
+	var token byte
+
+	if len(literals) < 15 {
+		token = byte(len(literals)) << 4
+	} else {
+		token = 0xf0
+	}
+
+	if n > 0 {
+		if n-lz4MinMatch < 15 {
+			token |= byte(n - lz4MinMatch)
+		} else {
+			token |= 0xf
+		}
+	}
+
+	dst = append(dst, token)
+	dst = lz4AppendLen(dst, len(literals))
+	dst = append(dst, literals...)
+
+	if n == 0 {
+		return dst
+	}
+
+	dst = append(dst, byte(offset), byte(offset>>8))
+	return lz4AppendLen(dst, n-lz4MinMatch)
+}
+
+// lz4AppendLen appends the extra bytes for a length which does not fit
+// in its token nibble.
+func lz4AppendLen(dst []byte, n int) []byte {
+	if n < 15 {
+		return dst
+	}
+
+	for n -= 15; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+
+	return append(dst, byte(n))
+}
+
+// lz4DecompressBlock decompresses the raw LZ4 block src into dst, which
+// must have the exact size of the uncompressed data.
+func lz4DecompressBlock(dst, src []byte) error {
+	var si, di int
+
+	readLen := func(n int) (int, bool) {
+		if n < 15 {
+			return n, true
+		}
+
+		for si < len(src) {
+			b := src[si]
+			si++
+			n += int(b)
+
+			if b < 255 {
+				return n, true
+			}
+		}
+
+		return 0, false
+	}
+
+	for si < len(src) {
+		token := src[si]
+		si++
+
+		n, ok := readLen(int(token >> 4))
+		if !ok || si+n > len(src) || di+n > len(dst) {
+			return errLZ4Corrupt
+		}
+
+		copy(dst[di:], src[si:si+n])
+		si += n
+		di += n
+
+		if si == len(src) {
+			break
+		}
+
+		if si+2 > len(src) {
+			return errLZ4Corrupt
+		}
+
+		offset := int(src[si]) | int(src[si+1])<<8
+		si += 2
+
+		n, ok = readLen(int(token & 0xf))
+		n += lz4MinMatch
+
+		if !ok || offset == 0 || offset > di || di+n > len(dst) {
+			return errLZ4Corrupt
+		}
+
+		// Matches may overlap the output being written; copy byte by byte.
+		for i := 0; i < n; i++ {
+			dst[di+i] = dst[di-offset+i]
+		}
+
+		di += n
+	}
+
+	if di != len(dst) {
+		return errLZ4Corrupt
+	}
+
+	return nil
+}
+
+// XXH32 primes.
+const (
+	xxhPrime1 uint32 = 2654435761
+	xxhPrime2 uint32 = 2246822519
+	xxhPrime3 uint32 = 3266489917
+	xxhPrime4 uint32 = 668265263
+	xxhPrime5 uint32 = 374761393
+)
+
+// xxh32 computes the 32-bit xxHash of b with the given seed.
+func xxh32(b []byte, seed uint32) uint32 {
+	var h uint32
+	n := len(b)
+
+	if n >= 16 {
+		v1 := seed + xxhPrime1 + xxhPrime2
+		v2 := seed + xxhPrime2
+		v3 := seed
+		v4 := seed - xxhPrime1
+
+		for ; len(b) >= 16; b = b[16:] {
+			v1 = xxhRound(v1, binary.LittleEndian.Uint32(b[0:]))
+			v2 = xxhRound(v2, binary.LittleEndian.Uint32(b[4:]))
+			v3 = xxhRound(v3, binary.LittleEndian.Uint32(b[8:]))
+			v4 = xxhRound(v4, binary.LittleEndian.Uint32(b[12:]))
+		}
+
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) +
+			bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = seed + xxhPrime5
+	}
+
+	h += uint32(n)
+
+	for ; len(b) >= 4; b = b[4:] {
+		h += binary.LittleEndian.Uint32(b) * xxhPrime3
+		h = bits.RotateLeft32(h, 17) * xxhPrime4
+	}
+
+	for _, c := range b {
+		h += uint32(c) * xxhPrime5
+		h = bits.RotateLeft32(h, 11) * xxhPrime1
+	}
+
+	h ^= h >> 15
+	h *= xxhPrime2
+	h ^= h >> 13
+	h *= xxhPrime3
+	h ^= h >> 16
+	return h
+}
+
+func xxhRound(acc, v uint32) uint32 {
+	return bits.RotateLeft32(acc+v*xxhPrime2, 13) * xxhPrime1
+}
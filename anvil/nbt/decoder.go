@@ -6,6 +6,7 @@ package nbt
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"reflect"
 	"strconv"
@@ -63,6 +64,11 @@ func (d *Decoder) decode(id tagId, name string, rv reflect.Value) error {
 		rv = rv.Elem()
 	}
 
+	// Dynamic values are read as-is, without a predefined structure.
+	if isDynamic(rv.Type()) {
+		return d.decodeDynamic(id, name, rv)
+	}
+
 	//fmt.Printf("%s(%q) => %v\n", id, name, rv)
 
 	var err error
@@ -99,7 +105,7 @@ func (d *Decoder) decodeCompound(name string, rv reflect.Value) error {
 		fv := readField(rv, name)
 
 		if fv.Kind() == reflect.Invalid {
-			err = d.skip(id)
+			err = d.decodeRemain(id, name, rv)
 		} else {
 			err = d.decode(id, name, fv)
 		}
@@ -112,6 +118,24 @@ func (d *Decoder) decodeCompound(name string, rv reflect.Value) error {
 	return nil
 }
 
+// decodeRemain stores a tag for which the given struct has no matching
+// field, in the struct's "remain" field. The tag is skipped if no such
+// field exists.
+func (d *Decoder) decodeRemain(id tagId, name string, rv reflect.Value) error {
+	fv := remainField(rv)
+	if fv.Kind() == reflect.Invalid {
+		return d.skip(id)
+	}
+
+	value, err := d.readValue(id)
+	if err != nil {
+		return err
+	}
+
+	fv.Set(reflect.Append(fv, reflect.ValueOf(Tag{Name: name, Value: value})))
+	return nil
+}
+
 func (d *Decoder) decodeList(name string, rv reflect.Value) error {
 	if rv.Kind() != reflect.Slice {
 		return fmt.Errorf("%s(%q): value %v must be slice", tagCompound, name, rv)
@@ -183,6 +207,8 @@ func (d *Decoder) decodeValue(id tagId, name string, rv reflect.Value) error {
 		value, err = d.readByteArray()
 	case tagIntArray:
 		value, err = d.readIntArray()
+	case tagLongArray:
+		value, err = d.readLongArray()
 	default:
 		err = fmt.Errorf("unsupported value %s for field %q", id, name)
 	}
@@ -194,6 +220,21 @@ func (d *Decoder) decodeValue(id tagId, name string, rv reflect.Value) error {
 	return d.set(id, name, rv, value)
 }
 
+// decodeDynamic reads a tag into its dynamic representation and assigns
+// it to the given Tag, Compound, List or empty interface value.
+func (d *Decoder) decodeDynamic(id tagId, name string, rv reflect.Value) error {
+	value, err := d.readValue(id)
+	if err != nil {
+		return err
+	}
+
+	if rv.Type() == reflect.TypeOf(Tag{}) {
+		value = Tag{Name: name, Value: value}
+	}
+
+	return d.set(id, name, rv, value)
+}
+
 // set assigns src to dst if possible.
 // It performs implicit type conversions where applicable.
 func (d *Decoder) set(id tagId, name string, dst reflect.Value, src interface{}) error {
@@ -299,9 +340,11 @@ func (d *Decoder) skipValue(id tagId) error {
 	case tagString:
 		_, err = d.readString()
 	case tagByteArray:
-		_, err = d.readByteArray()
+		err = d.skipArray(id, 1)
 	case tagIntArray:
-		_, err = d.readIntArray()
+		err = d.skipArray(id, 4)
+	case tagLongArray:
+		err = d.skipArray(id, 8)
 	default:
 		err = fmt.Errorf("unsupported value %s", id)
 	}
@@ -309,6 +352,121 @@ func (d *Decoder) skipValue(id tagId) error {
 	return err
 }
 
+// skipArray skips an array of the given type, whose elements are of the
+// given size, without decoding it.
+func (d *Decoder) skipArray(id tagId, size int64) error {
+	n, err := d.readInt()
+	if err != nil {
+		return err
+	}
+
+	if n < 0 {
+		return fmt.Errorf("%s with size < 0", id)
+	}
+
+	_, err = io.CopyN(ioutil.Discard, d.r, int64(n)*size)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// readValue reads the payload for a tag of the given type.
+// Refer to the Tag type for the types of values this yields.
+func (d *Decoder) readValue(id tagId) (interface{}, error) {
+	var value interface{}
+	var err error
+
+	switch id {
+	case tagList:
+		value, err = d.readList()
+	case tagCompound:
+		value, err = d.readCompound()
+	case tagByte:
+		value, err = d.readByte()
+	case tagShort:
+		value, err = d.readShort()
+	case tagInt:
+		value, err = d.readInt()
+	case tagLong:
+		value, err = d.readLong()
+	case tagFloat:
+		value, err = d.readFloat()
+	case tagDouble:
+		value, err = d.readDouble()
+	case tagString:
+		value, err = d.readString()
+	case tagByteArray:
+		value, err = d.readByteArray()
+	case tagIntArray:
+		value, err = d.readIntArray()
+	case tagLongArray:
+		value, err = d.readLongArray()
+	default:
+		err = fmt.Errorf("unsupported value %s", id)
+	}
+
+	return value, err
+}
+
+func (d *Decoder) readCompound() (Compound, error) {
+	var out Compound
+
+	for {
+		id, name, err := d.readHeader(tagUnknown)
+		if err != nil {
+			return nil, err
+		}
+
+		if id == tagEnd {
+			return out, nil
+		}
+
+		value, err := d.readValue(id)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, Tag{Name: name, Value: value})
+	}
+}
+
+func (d *Decoder) readList() (List, error) {
+	n, err := d.readByte()
+	if err != nil {
+		return List{}, err
+	}
+
+	size, err := d.readInt()
+	if err != nil {
+		return List{}, err
+	}
+
+	if size < 0 {
+		return List{}, fmt.Errorf("%s with size < 0", tagList)
+	}
+
+	// The element type is only retained for empty lists.
+	// Otherwise it is implied by the values themselves.
+	if size == 0 {
+		return List{id: tagId(n)}, nil
+	}
+
+	var out List
+
+	for i := 0; i < int(size); i++ {
+		value, err := d.readValue(tagId(n))
+		if err != nil {
+			return List{}, err
+		}
+
+		out.Values = append(out.Values, value)
+	}
+
+	return out, nil
+}
+
 // readHeader reads the next tag header.
 func (d *Decoder) readHeader(id tagId) (tagId, string, error) {
 	if id != tagUnknown {
@@ -438,6 +596,44 @@ func (d *Decoder) readIntArray() ([]int32, error) {
 	return out, nil
 }
 
+func (d *Decoder) readLongArray() ([]int64, error) {
+	size, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+
+	if size < 0 {
+		return nil, fmt.Errorf("%s with size < 0", tagLongArray)
+	}
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	out := make([]int64, size)
+
+	for i := 0; i < int(size); i++ {
+		out[i], err = d.readLong()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// isDynamic returns true if values of the given type are decoded without
+// a predefined structure. This applies to Tag, Compound, List and the
+// empty interface.
+func isDynamic(rt reflect.Type) bool {
+	switch rt {
+	case reflect.TypeOf(Tag{}), reflect.TypeOf(Compound{}), reflect.TypeOf(List{}):
+		return true
+	}
+
+	return rt.Kind() == reflect.Interface && rt.NumMethod() == 0
+}
+
 // readField finds a field in the given struct with the specified name
 // and returns its value.
 //
@@ -461,6 +657,10 @@ func readField(rv reflect.Value, name string) reflect.Value {
 	for i := 0; i < rv.NumField(); i++ {
 		ft := rt.Field(i)
 
+		if isRemain(ft) || isIgnored(ft) {
+			continue
+		}
+
 		if hasFieldName(ft, name) {
 			return rv.Field(i)
 		}
@@ -478,6 +678,55 @@ func readField(rv reflect.Value, name string) reflect.Value {
 	return reflect.Value{}
 }
 
+// remainField finds the field in the given struct which collects tags
+// not matching any other field. This is a field of type Compound with the
+// "remain" option in its field tag. Anonymous, embedded structs are
+// searched as well.
+//
+// If no match can be found, reflect.Invalid is returned.
+func remainField(rv reflect.Value) reflect.Value {
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+
+	rt := rv.Type()
+
+	for i := 0; i < rv.NumField(); i++ {
+		ft := rt.Field(i)
+
+		if isRemain(ft) {
+			return rv.Field(i)
+		}
+
+		if !ft.Anonymous {
+			continue
+		}
+
+		ret := remainField(rv.Field(i))
+		if ret.Kind() != reflect.Invalid {
+			return ret
+		}
+	}
+
+	return reflect.Value{}
+}
+
+// isRemain returns true if the given struct field collects unknown tags.
+func isRemain(ft reflect.StructField) bool {
+	return ft.Type == reflect.TypeOf(Compound{}) &&
+		hasField(ft.Tag.Get("nbt"), "remain")
+}
+
+// isIgnored returns true if the given struct field is marked with the
+// "-" name in its field tag. These fields are never read or written.
+func isIgnored(ft reflect.StructField) bool {
+	return tagField(ft.Tag.Get("nbt"), 0) == "-"
+}
+
 // hasFieldName returns true if the given struct field has the specified name.
 // This first checks for the presence of a matching "nbt" field tag. Otherwise
 // the field name itself is considered.
@@ -564,6 +813,27 @@ func convert(rv reflect.Value, dst, src reflect.Type) (reflect.Value, error) {
 				ptr := (*(*[1<<31 - 1]int32)(unsafe.Pointer(&v[0])))[:len(v)]
 				return reflect.ValueOf(ptr), nil
 			}
+
+		case reflect.Int64:
+			v := rv.Interface().([]int64)
+
+			switch dst.Elem().Kind() {
+			case reflect.Int64, reflect.Uint64:
+				if len(v) == 0 {
+					return reflect.Zero(dst), nil
+				}
+
+				out := reflect.MakeSlice(dst, len(v), len(v))
+				for i, x := range v {
+					if dst.Elem().Kind() == reflect.Int64 {
+						out.Index(i).SetInt(x)
+					} else {
+						out.Index(i).SetUint(uint64(x))
+					}
+				}
+
+				return out, nil
+			}
 		}
 
 	case reflect.String:
@@ -46,6 +46,27 @@ Data can be re-encoded with the `Marshal` call, or directly through the
 	...
 
 
+Data which does not map onto a predefined structure can be decoded into a
+Tag, Compound or List value. These hold the tags in the order they were
+read, along with their exact types, so the data can be inspected, edited
+and written back without losing anything:
+
+	var root nbt.Tag
+	err = nbt.Unmarshal(gz, &root)
+	...
+
+	data, _ := root.Value.(nbt.Compound).Get("Data")
+	level := data.(nbt.Compound)
+	level.Set("LevelName", "test")
+	...
+
+	err = nbt.Marshal(w, root)
+	...
+
+Struct fields of type Tag, Compound, List or interface{} are decoded the
+same way.
+
+
 Type compatibility
 
 Some implicit type conversions can be achieved by adhering to the
@@ -78,6 +99,8 @@ following guidelines.
     -----------------------------------------------------------------------
     TAG_Int_Array  | []int32, []uint32   |
     -----------------------------------------------------------------------
+    TAG_Long_Array | []int64, []uint64   |
+    -----------------------------------------------------------------------
     TAG_String     | string              |
                    | bool                | Parsed using strconv.ParseBool()
     -----------------------------------------------------------------------
@@ -107,5 +130,25 @@ If the encoder should not output a tag for an empty field, append the
 
 If `len(T.Data) == 0`, the encoder will ignore this field and no tag is
 emitted.
+
+Fields with the name `-` in their struct field tag are ignored by both
+the decoder and the encoder:
+
+	type T struct {
+		Cache []byte `nbt:"-"`
+	}
+
+Tags for which a struct has no matching field are normally skipped by the
+decoder. To retain them, add a field of type Compound with the `remain`
+value in its struct field tag. For example:
+
+	type T struct {
+		Data    []byte       `nbt:"data"`
+		Unknown nbt.Compound `nbt:",remain"`
+	}
+
+All unmatched tags are collected in `T.Unknown`. The encoder writes them
+back out as part of the same compound, so no data is lost when a value is
+decoded, modified and encoded again.
 */
 package nbt
@@ -44,13 +44,31 @@ func (e *Encoder) Encode(v interface{}) error {
 // Encode translates v into uncompressed, NBT-encoded data and writes
 // it to the underlying stream.
 func (e *Encoder) encode(rv reflect.Value, name string, inlist bool) error {
+	if !rv.IsValid() {
+		return &MarshalError{Name: name}
+	}
+
 	if rv.Kind() == reflect.Ptr && rv.IsNil() {
 		return nil
 	}
 
 	rv = reflect.Indirect(rv)
 
+	switch rv.Type() {
+	case reflect.TypeOf(Tag{}):
+		return e.encodeTag(rv.Interface().(Tag), inlist)
+
+	case reflect.TypeOf(Compound{}):
+		return e.encodeCompound(rv.Interface().(Compound), name, inlist)
+
+	case reflect.TypeOf(List{}):
+		return e.encodeDynamicList(rv.Interface().(List), name, inlist)
+	}
+
 	switch rv.Kind() {
+	case reflect.Interface:
+		return e.encode(rv.Elem(), name, inlist)
+
 	case reflect.Struct:
 		return e.encodeStruct(rv, name, inlist)
 
@@ -97,6 +115,22 @@ func (e *Encoder) encodeStruct(rv reflect.Value, name string, inlist bool) error
 		fv := rv.Field(i)
 		ft := rt.Field(i)
 
+		// Unexported and ignored fields are never written.
+		if len(ft.PkgPath) > 0 || isIgnored(ft) {
+			continue
+		}
+
+		// Unknown tags are written back as-is, as part of this compound.
+		if isRemain(ft) {
+			for _, t := range fv.Interface().(Compound) {
+				err = e.encodeTag(t, false)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
 		if hasField(ft.Tag.Get("nbt"), "omitempty") && isEmpty(fv) {
 			continue
 		}
@@ -121,6 +155,67 @@ func (e *Encoder) encodeStruct(rv reflect.Value, name string, inlist bool) error
 	return e.writeU8(uint8(tagEnd))
 }
 
+// encodeTag writes the given tag using its own name.
+func (e *Encoder) encodeTag(t Tag, inlist bool) error {
+	return e.encode(reflect.ValueOf(t.Value), t.Name, inlist)
+}
+
+func (e *Encoder) encodeCompound(c Compound, name string, inlist bool) error {
+	err := e.emit(tagCompound, name, inlist)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range c {
+		err = e.encodeTag(t, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.writeU8(uint8(tagEnd))
+}
+
+// encodeDynamicList writes the given list. The element type is determined
+// by the values in the list. An empty list retains the element type it was
+// read with.
+func (e *Encoder) encodeDynamicList(l List, name string, inlist bool) error {
+	id := l.id
+
+	for i, v := range l.Values {
+		vid, ok := valueId(reflect.ValueOf(v))
+		if !ok || (i > 0 && vid != id) {
+			return &MarshalError{Name: name, Type: reflect.TypeOf(v)}
+		}
+
+		id = vid
+	}
+
+	err := e.emit(tagList, name, inlist)
+	if err != nil {
+		return err
+	}
+
+	err = e.writeU8(uint8(id))
+	if err != nil {
+		return err
+	}
+
+	err = e.writeU32(uint32(len(l.Values)))
+	if err != nil {
+		return err
+	}
+
+	for _, v := range l.Values {
+		err = e.encode(reflect.ValueOf(v), "", true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // isTime returns true if rv is a valid type for time.Time.
 func (e *Encoder) isTime(rt reflect.Type) bool {
 	var t time.Time
@@ -139,11 +234,12 @@ func (e *Encoder) encodeSlice(rv reflect.Value, name string, inlist bool) error
 	case reflect.Int32, reflect.Uint32:
 		return e.encodeIntArray(rv, name, inlist)
 
+	case reflect.Int64, reflect.Uint64:
+		return e.encodeLongArray(rv, name, inlist)
+
 	default:
 		return e.encodeList(rv, name, inlist)
 	}
-
-	return nil
 }
 
 func (e *Encoder) encodeByteArray(rv reflect.Value, name string, inlist bool) error {
@@ -205,6 +301,42 @@ func (e *Encoder) encodeIntArray(rv reflect.Value, name string, inlist bool) err
 	return err
 }
 
+func (e *Encoder) encodeLongArray(rv reflect.Value, name string, inlist bool) error {
+	err := e.emit(tagLongArray, name, inlist)
+	if err != nil {
+		return err
+	}
+
+	size := uint32(rv.Len())
+	err = e.writeU32(size)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	out := make([]byte, 0, size*8)
+
+	for i := 0; i < rv.Len(); i++ {
+		var v uint64
+
+		if iv := rv.Index(i); iv.Kind() == reflect.Int64 {
+			v = uint64(iv.Int())
+		} else {
+			v = iv.Uint()
+		}
+
+		out = append(out,
+			byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+
+	_, err = e.w.Write(out)
+	return err
+}
+
 func (e *Encoder) encodeList(rv reflect.Value, name string, inlist bool) error {
 	err := e.emit(tagList, name, inlist)
 	if err != nil {
@@ -230,9 +362,6 @@ func (e *Encoder) encodeList(rv reflect.Value, name string, inlist bool) error {
 	case reflect.Uint16, reflect.Int16:
 		id = tagShort
 
-	case reflect.Uint64, reflect.Int64:
-		id = tagLong
-
 	case reflect.Float32:
 		id = tagFloat
 
@@ -473,6 +602,63 @@ func (e *Encoder) writeU64(v uint64) error {
 	return err
 }
 
+// valueId returns the tag type the encoder emits for the given value.
+// Returns false if the value can not be encoded.
+func valueId(rv reflect.Value) (tagId, bool) {
+	if !rv.IsValid() {
+		return tagEnd, false
+	}
+
+	rv = reflect.Indirect(rv)
+	if !rv.IsValid() {
+		return tagEnd, false
+	}
+
+	switch rv.Type() {
+	case reflect.TypeOf(Tag{}):
+		return valueId(reflect.ValueOf(rv.Interface().(Tag).Value))
+	case reflect.TypeOf(Compound{}):
+		return tagCompound, true
+	case reflect.TypeOf(List{}):
+		return tagList, true
+	case reflect.TypeOf(time.Time{}):
+		return tagLong, true
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		return valueId(rv.Elem())
+	case reflect.Struct:
+		return tagCompound, true
+	case reflect.Array, reflect.Slice:
+		switch rv.Type().Elem().Kind() {
+		case reflect.Int8, reflect.Uint8:
+			return tagByteArray, true
+		case reflect.Int32, reflect.Uint32:
+			return tagIntArray, true
+		case reflect.Int64, reflect.Uint64:
+			return tagLongArray, true
+		}
+		return tagList, true
+	case reflect.String:
+		return tagString, true
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return tagByte, true
+	case reflect.Int16, reflect.Uint16:
+		return tagShort, true
+	case reflect.Int32, reflect.Uint32:
+		return tagInt, true
+	case reflect.Int64, reflect.Uint64:
+		return tagLong, true
+	case reflect.Float32:
+		return tagFloat, true
+	case reflect.Float64:
+		return tagDouble, true
+	}
+
+	return tagEnd, false
+}
+
 // isEmpty returns true if the given value defines a zero value for whatever
 // type it represents.
 func isEmpty(rv reflect.Value) bool {
@@ -6,6 +6,7 @@ package nbt
 import (
 	"bytes"
 	"compress/gzip"
+	"io/ioutil"
 	"reflect"
 	"testing"
 	"time"
@@ -210,6 +211,24 @@ func TestList2(t *testing.T) {
 	testRoundtrip(t, &a, &b)
 }
 
+func TestLongArray1(t *testing.T) {
+	var a, b []int64
+	a = []int64{-1, 2, -3, 1 << 62}
+	testRoundtrip(t, &a, &b)
+}
+
+func TestLongArray2(t *testing.T) {
+	type Test struct {
+		A []uint64
+		B Compound
+	}
+
+	var a, b Test
+	a.A = []uint64{1, 2, 3, 1 << 63}
+	a.B.Set("C", []int64{4, 5, 6})
+	testRoundtrip(t, &a, &b)
+}
+
 func TestCompoundList(t *testing.T) {
 	type Data struct {
 		A int8
@@ -258,6 +277,155 @@ func TestSmall(t *testing.T) {
 	testRoundtrip(t, &a, &b)
 }
 
+func TestTagBig(t *testing.T) {
+	testTagRoundtrip(t, big_nbt)
+}
+
+func TestTagSmall(t *testing.T) {
+	testTagRoundtrip(t, small_nbt)
+}
+
+func TestCompoundSet(t *testing.T) {
+	type Test struct {
+		A int8
+		B Compound
+	}
+
+	var a, b Test
+	a.A = 123
+	a.B.Set("x", int32(1))
+	a.B.Set("y", "test")
+	a.B.Set("z", List{Values: []interface{}{int16(1), int16(2)}})
+	a.B.Set("x", int32(2))
+	a.B.Delete("y")
+	testRoundtrip(t, &a, &b)
+
+	if v, ok := b.B.Get("x"); !ok || v != int32(2) {
+		t.Fatalf("Get(x) mismatch:\nHave: %v\nWant: %v", v, int32(2))
+	}
+
+	if _, ok := b.B.Get("y"); ok {
+		t.Fatalf("Get(y): expected tag to be deleted")
+	}
+}
+
+func TestEmptyList(t *testing.T) {
+	type Test struct {
+		A Compound
+	}
+
+	var a, b Test
+	a.A.Set("strings", NewList(""))
+	a.A.Set("compounds", NewList(Compound{}))
+
+	// The decoded lists must carry the same element types.
+	testRoundtrip(t, &a, &b)
+
+	if reflect.DeepEqual(b.A[0].Value, NewList(int32(0))) {
+		t.Fatalf("expected element types to differ")
+	}
+}
+
+func TestRemain(t *testing.T) {
+	type Full struct {
+		A int8
+		B string
+		C []int32
+		D struct {
+			E float64
+		}
+	}
+
+	type Partial struct {
+		B       string
+		Unknown Compound `nbt:",remain"`
+	}
+
+	var a, c Full
+	a.A = 123
+	a.B = "test"
+	a.C = []int32{1, 2, 3}
+	a.D.E = 1.234
+
+	var b Partial
+	testConvert(t, &a, &b)
+
+	if len(b.Unknown) != 3 {
+		t.Fatalf("expected 3 unknown tags; have %d", len(b.Unknown))
+	}
+
+	b.B = "changed"
+	a.B = "changed"
+	testConvert(t, &b, &c)
+
+	if !reflect.DeepEqual(a, c) {
+		t.Fatalf("roundtrip mismatch:\nHave: %#v\nWant: %#v", c, a)
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	type Test struct {
+		A int8
+		B string `nbt:"-"`
+	}
+
+	var a, b Test
+	a.A = 123
+	a.B = "test"
+	testConvert(t, &a, &b)
+
+	if b.A != a.A || len(b.B) > 0 {
+		t.Fatalf("mismatch:\nHave: %#v\nWant: %#v", b, Test{A: a.A})
+	}
+}
+
+// testConvert encodes src and then decodes it into dst.
+func testConvert(t *testing.T, src, dst interface{}) {
+	var buf bytes.Buffer
+
+	err := Marshal(&buf, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Unmarshal(&buf, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testTagRoundtrip decodes the given, compressed data into a Tag and
+// encodes it again. The output should be identical to the input.
+func testTagRoundtrip(t *testing.T, data []byte) {
+	r, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	want, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tag Tag
+	err = Unmarshal(bytes.NewReader(want), &tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var have bytes.Buffer
+	err = Marshal(&have, tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(want, have.Bytes()) {
+		t.Fatalf("roundtrip mismatch:\nHave: %v\nWant: %v", have.Bytes(), want)
+	}
+}
+
 // testRoundtrip encodes <want> and then decodes into <have>.
 // The two should then be equal.
 func testRoundtrip(t *testing.T, want, have interface{}) {
@@ -5,6 +5,8 @@
 
 package nbt
 
+import "reflect"
+
 // tagId describes a type oftag.
 type tagId uint8
 
@@ -22,5 +24,92 @@ const (
 	tagList      tagId = 0x9
 	tagCompound  tagId = 0xa
 	tagIntArray  tagId = 0xb
-	tagUnknown   tagId = 0xc
+	tagLongArray tagId = 0xc
+	tagUnknown   tagId = 0xff
 )
+
+// Tag defines a single, named tag with a dynamic value.
+//
+// The value holds one of the following types, depending on the tag type:
+//
+//	TAG_Byte       | int8
+//	TAG_Short      | int16
+//	TAG_Int        | int32
+//	TAG_Long       | int64
+//	TAG_Float      | float32
+//	TAG_Double     | float64
+//	TAG_Byte_Array | []byte
+//	TAG_Int_Array  | []int32
+//	TAG_Long_Array | []int64
+//	TAG_String     | string
+//	TAG_List       | List
+//	TAG_Compound   | Compound
+//
+// A Tag is always encoded using its own name, regardless of the name of
+// the struct field it is assigned to.
+type Tag struct {
+	Name  string
+	Value interface{}
+}
+
+// Compound defines the contents of a TAG_Compound as an ordered set of
+// named tags. The order in which tags are read is retained when the
+// compound is written back out.
+type Compound []Tag
+
+// Get returns the value of the tag with the given name.
+// Returns false if no such tag exists.
+func (c Compound) Get(name string) (interface{}, bool) {
+	for i := range c {
+		if c[i].Name == name {
+			return c[i].Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Set assigns v to the tag with the given name.
+// The tag is appended to the compound if it does not yet exist.
+func (c *Compound) Set(name string, v interface{}) {
+	for i := range *c {
+		if (*c)[i].Name == name {
+			(*c)[i].Value = v
+			return
+		}
+	}
+
+	*c = append(*c, Tag{Name: name, Value: v})
+}
+
+// Delete removes the tag with the given name.
+// Returns false if no such tag exists.
+func (c *Compound) Delete(name string) bool {
+	for i := range *c {
+		if (*c)[i].Name == name {
+			*c = append((*c)[:i], (*c)[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// List defines the contents of a TAG_List. Each value holds one of the
+// types listed for Tag.Value. All values must be of the same type.
+//
+// The element type of a list is implied by its values. Empty lists keep
+// the element type they were read with, or created with by NewList.
+// A zero List is written as a list of TAG_End.
+type List struct {
+	Values []interface{}
+	id     tagId // Element type of an empty list.
+}
+
+// NewList creates an empty list, which is written with the tag type of
+// elem as its element type. Elem holds one of the types listed for
+// Tag.Value; its value is not used.
+func NewList(elem interface{}) List {
+	id, _ := valueId(reflect.ValueOf(elem))
+	return List{id: id}
+}
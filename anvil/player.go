@@ -3,6 +3,8 @@
 
 package anvil
 
+import "github.com/kpfaulkner/mctools/anvil/nbt"
+
 // Player defines all properties for a single player.
 // For single-player games, this is part of level.dat.
 // For servers, this is stored in separate files in the $WORLD/playerdata/ directory.
@@ -42,4 +44,5 @@ type Player struct {
 	Sleeping            bool            `nbt:"Sleeping"`
 	Invulnerable        bool            `nbt:"Invulnerable"`
 	OnGround            bool            `nbt:"OnGround"`
+	Unknown             nbt.Compound    `nbt:",remain"`
 }
@@ -5,8 +5,10 @@ package anvil
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -32,6 +34,21 @@ const (
 
 	// Defines the byte size of a single sector.
 	sectorSize = 4096
+
+	// Defines the byte size of the length and compression scheme which
+	// precede the data of each chunk.
+	chunkHeaderSize = 5
+
+	// Defines the largest number of sectors a chunk can occupy in a region.
+	// Larger chunks are stored in a separate file.
+	maxChunkSectors = 255
+
+	// Flag set on the compression scheme of chunks stored in a separate file.
+	externalFlag = 0x80
+
+	// ExternalFileExtension defines the file extension for chunks stored
+	// outside of their region file.
+	ExternalFileExtension = ".mcc"
 )
 
 // RegionCoords returns the x and z coordinates associated with the
@@ -57,9 +74,16 @@ func RegionCoords(name string) (int, int, bool) {
 // A region describes chunks with block data in a Minecraft world.
 type Region struct {
 	file   string                 // Input file for this region.
+	fd     *os.File               // Open input file for lazily loaded chunks.
 	chunks [1024]*ChunkDescriptor // Chunk definitions in this region.
 	X      int                    // Region's X coordinate.
 	Z      int                    // Region's Z coordinate.
+
+	// Compression scheme and level used for chunks written through
+	// WriteChunk and EncodeChunk. These default to ZLib and
+	// DefaultCompression. The level applies to GZip and ZLib only.
+	Scheme           byte
+	CompressionLevel int
 }
 
 // CreateRegion creates an empty region file at the given location.
@@ -88,10 +112,31 @@ func CreateRegion(file string) (*Region, error) {
 	return LoadRegion(file)
 }
 
-// LoadRegion opens a region from the given file.
+// LoadRegion opens a region from the given file and reads the data for
+// all its chunks into memory. It fails if any chunk can not be read; use
+// SalvageRegion to recover the healthy chunks of a damaged region.
 func LoadRegion(file string) (*Region, error) {
-	var err error
+	r, err := OpenRegion(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	err = r.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
 
+// OpenRegion opens a region from the given file. Only the header is read
+// up front. Chunk data is read from the file when it is first accessed.
+//
+// The file is kept open until Region.Close is called. Chunks which have
+// not been accessed by then are no longer available.
+func OpenRegion(file string) (*Region, error) {
 	rx, rz, ok := RegionCoords(file)
 	if !ok {
 		return nil, fmt.Errorf("anvil: open region: invalid file %q", file)
@@ -102,21 +147,23 @@ func LoadRegion(file string) (*Region, error) {
 		return nil, fmt.Errorf("anvil: r(%d %d): %v", rx, rz, err)
 	}
 
-	defer fd.Close()
-
 	// Read header data.
 	locations, timestamps, err := readHeader(fd)
 	if err != nil {
+		fd.Close()
 		return nil, fmt.Errorf("anvil: r(%d %d): read header: %v", rx, rz, err)
 	}
 
 	r := &Region{
-		file: file,
-		X:    rx,
-		Z:    rz,
+		file:             file,
+		fd:               fd,
+		X:                rx,
+		Z:                rz,
+		Scheme:           ZLib,
+		CompressionLevel: DefaultCompression,
 	}
 
-	// Load up all valid chunk descriptors.
+	// Set up all valid chunk descriptors.
 	for x := 0; x < ChunksPerRegion; x++ {
 		for z := 0; z < ChunksPerRegion; z++ {
 			offset, sectors := readOffset(locations, x, z)
@@ -126,11 +173,12 @@ func LoadRegion(file string) (*Region, error) {
 				continue
 			}
 
-			n := chunkIndex(x, z)
-			r.chunks[n], err = readChunk(fd, x, z, offset, timestamps)
-			if err != nil {
-				return nil, fmt.Errorf("anvil: r(%d %d) c(%d %d): read chunk: %v",
-					rx, rz, x, z, err)
+			r.chunks[chunkIndex(x, z)] = &ChunkDescriptor{
+				X:            x,
+				Z:            z,
+				LastModified: readTimestamp(timestamps, x, z),
+				sector:       offset,
+				sectors:      sectors,
 			}
 		}
 	}
@@ -138,38 +186,322 @@ func LoadRegion(file string) (*Region, error) {
 	return r, nil
 }
 
+// Close closes the underlying file of a region opened with OpenRegion.
+// It is a no-op for regions which have been loaded completely.
+func (r *Region) Close() error {
+	if r.fd == nil {
+		return nil
+	}
+
+	err := r.fd.Close()
+	r.fd = nil
+	return err
+}
+
+// load reads the compressed data for the chunk at the given index from
+// the underlying file, if this has not happened yet.
+func (r *Region) load(n int) error {
+	cd := r.chunks[n]
+	if cd == nil || cd.loaded() {
+		return nil
+	}
+
+	if r.fd == nil {
+		return errors.New("region is closed")
+	}
+
+	err := readChunk(r.fd, cd, cd.sector)
+	if err != nil || cd.scheme&externalFlag == 0 {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(r.externalFile(cd))
+	if err != nil {
+		cd.data = nil
+		return err
+	}
+
+	cd.scheme &^= externalFlag
+	cd.data = data
+	return nil
+}
+
+// externalFile returns the name of the file holding the data for the
+// given chunk, if it is too large to fit in the region.
+//
+// The name is in the form 'c.<X>.<Z>.mcc', where X and Z are the absolute
+// chunk coordinates. It is stored next to the region file.
+func (r *Region) externalFile(cd *ChunkDescriptor) string {
+	x := r.X*ChunksPerRegion + cd.X
+	z := r.Z*ChunksPerRegion + cd.Z
+	name := fmt.Sprintf("c.%d.%d%s", x, z, ExternalFileExtension)
+	return filepath.Join(filepath.Dir(r.file), name)
+}
+
+// writeExternal writes the data for the given chunk into its external
+// file, if it is too large to fit in the region.
+func (r *Region) writeExternal(cd *ChunkDescriptor) error {
+	if !cd.external() {
+		return nil
+	}
+
+	return writeFile(r.externalFile(cd), "", func(fd *os.File) error {
+		_, err := fd.Write(cd.data)
+		return err
+	})
+}
+
+// removeExternal removes the external file for the given chunk, if it
+// exists and the chunk no longer needs it.
+func (r *Region) removeExternal(cd *ChunkDescriptor) error {
+	if cd.external() {
+		return nil
+	}
+
+	err := os.Remove(r.externalFile(cd))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// loadAll reads the compressed data for all chunks which have not
+// been read yet.
+func (r *Region) loadAll() error {
+	for n, cd := range r.chunks {
+		if cd == nil {
+			continue
+		}
+
+		err := r.load(n)
+		if err != nil {
+			return r.chunkError(cd.X, cd.Z, "read chunk", err)
+		}
+	}
+
+	return nil
+}
+
 // Save writes all region data to the underlying file.
+//
+// The data is written to a temporary file first, which then replaces the
+// original. The original is left intact if saving fails.
 func (r *Region) Save() error {
-	fd, err := os.Create(r.file)
+	return r.save("")
+}
+
+// SaveWithBackup writes all region data to the underlying file, like Save.
+// The previous version of the file is kept with RegionBackupSuffix appended
+// to its name.
+func (r *Region) SaveWithBackup() error {
+	return r.save(r.file + RegionBackupSuffix)
+}
+
+// save writes all region data to the underlying file, optionally keeping
+// the previous version in the given backup file.
+func (r *Region) save(backup string) error {
+	// Chunk data still on disk must be read before the file is replaced.
+	err := r.loadAll()
 	if err != nil {
-		return fmt.Errorf("anvil: r(%d %d): %v", r.X, r.Z, err)
+		return err
 	}
 
-	defer fd.Close()
+	offset := 2 // Skip first two offsets for header data.
+
+	for _, cd := range r.chunks {
+		if cd == nil {
+			continue
+		}
+
+		cd.sector = offset
+		cd.sectors = cd.SectorCount()
+		offset += cd.sectors
+
+		if cd.dirty {
+			err = r.writeExternal(cd)
+			if err != nil {
+				return r.chunkError(cd.X, cd.Z, "write chunk", err)
+			}
+		}
+	}
+
+	err = writeFile(r.file, backup, func(fd *os.File) error {
+		err := writeHeader(fd, r.chunks[:])
+		if err != nil {
+			return err
+		}
+
+		for _, cd := range r.chunks {
+			if cd == nil {
+				continue
+			}
+
+			err = writeChunk(fd, cd, cd.sector)
+			if err != nil {
+				return r.chunkError(cd.X, cd.Z, "write chunk", err)
+			}
+		}
+
+		return nil
+	})
 
-	err = writeHeader(fd, r.chunks[:])
+	if err != nil {
+		if _, ok := err.(*ChunkError); !ok {
+			err = fmt.Errorf("anvil: r(%d %d): %v", r.X, r.Z, err)
+		}
+		return err
+	}
+
+	for _, cd := range r.chunks {
+		if cd == nil || !cd.dirty {
+			continue
+		}
+
+		err = r.removeExternal(cd)
+		if err != nil {
+			return r.chunkError(cd.X, cd.Z, "write chunk", err)
+		}
+
+		cd.dirty = false
+	}
+
+	// The open file, if any, refers to the replaced data. All chunks have
+	// been read into memory, so it is no longer needed.
+	return r.Close()
+}
+
+// SaveInPlace writes modified chunks to the underlying file, keeping the
+// existing sector layout intact.
+//
+// Chunks which still fit in their current sectors are overwritten in place.
+// Others are moved to the first free range of sectors large enough to hold
+// them, or appended to the end of the file. Unmodified chunks are not
+// touched, so saving a region after changing a single chunk only writes
+// that chunk and the header.
+//
+// Unlike Save, this writes to the file directly. A crash halfway through
+// may leave the region damaged.
+func (r *Region) SaveInPlace() error {
+	fd, err := os.OpenFile(r.file, os.O_RDWR, 0)
 	if err != nil {
 		return fmt.Errorf("anvil: r(%d %d): %v", r.X, r.Z, err)
 	}
 
-	offset := 2 // Skip first two offsets for header data.
+	defer fd.Close()
+
+	// Mark the sectors used by the header and all unmodified chunks.
+	used := []bool{true, true}
 
 	for _, cd := range r.chunks {
-		if cd == nil {
+		if cd != nil && !cd.dirty && cd.sector > 0 {
+			used = markSectors(used, cd.sector, cd.sectors)
+		}
+	}
+
+	for _, cd := range r.chunks {
+		if cd == nil || (!cd.dirty && cd.sector > 0) {
 			continue
 		}
 
-		err = writeChunk(fd, cd, offset)
+		sector := cd.sector
+		sectors := cd.SectorCount()
+
+		if sector == 0 || !freeSectors(used, sector, sectors) {
+			sector = findSectors(used, sectors)
+		}
+
+		used = markSectors(used, sector, sectors)
+
+		err = r.writeExternal(cd)
+		if err == nil {
+			err = writeChunk(fd, cd, sector)
+		}
+
+		if err == nil {
+			err = r.removeExternal(cd)
+		}
+
 		if err != nil {
-			return fmt.Errorf("anvil: r(%d %d) c(%d %d): %v", r.X, r.Z, cd.X, cd.Z, err)
+			return r.chunkError(cd.X, cd.Z, "write chunk", err)
 		}
 
-		offset += cd.SectorCount()
+		cd.sector = sector
+		cd.sectors = sectors
+		cd.dirty = false
+	}
+
+	err = writeHeader(fd, r.chunks[:])
+	if err != nil {
+		return fmt.Errorf("anvil: r(%d %d): %v", r.X, r.Z, err)
+	}
+
+	// Drop trailing sectors which are no longer in use.
+	size := len(used)
+	for size > 2 && !used[size-1] {
+		size--
+	}
+
+	stat, err := fd.Stat()
+	if err != nil {
+		return fmt.Errorf("anvil: r(%d %d): %v", r.X, r.Z, err)
+	}
+
+	if stat.Size() > int64(size)*sectorSize {
+		err = fd.Truncate(int64(size) * sectorSize)
+		if err != nil {
+			return fmt.Errorf("anvil: r(%d %d): %v", r.X, r.Z, err)
+		}
 	}
 
 	return nil
 }
 
+// markSectors marks the given sector range as used, growing the set
+// as necessary.
+func markSectors(used []bool, sector, sectors int) []bool {
+	for len(used) < sector+sectors {
+		used = append(used, false)
+	}
+
+	for i := sector; i < sector+sectors; i++ {
+		used[i] = true
+	}
+
+	return used
+}
+
+// freeSectors returns true if none of the given sectors are in use.
+func freeSectors(used []bool, sector, sectors int) bool {
+	for i := sector; i < sector+sectors && i < len(used); i++ {
+		if used[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findSectors returns the offset of the first range of unused sectors
+// large enough to hold the given number of sectors. This may be past the
+// end of the set.
+func findSectors(used []bool, sectors int) int {
+	run := 0
+
+	for i := range used {
+		if used[i] {
+			run = 0
+			continue
+		}
+
+		if run++; run == sectors {
+			return i - sectors + 1
+		}
+	}
+
+	return len(used) - run
+}
+
 // Clear removes all blocks and all chunks from the region.
 // Note that Region.Save() must be called to persist these changes.
 func (r *Region) Clear() {
@@ -200,6 +532,21 @@ func (r *Region) ChunkLen() int {
 	return count
 }
 
+// LoadedSize returns the number of bytes of compressed chunk data the
+// region holds in memory. For regions opened with OpenRegion, this grows
+// as chunks are read.
+func (r *Region) LoadedSize() int64 {
+	var n int64
+
+	for _, cd := range r.chunks {
+		if cd != nil {
+			n += int64(len(cd.data))
+		}
+	}
+
+	return n
+}
+
 // Chunks yields a list of chunk X/Z cooridnates for all valid chunks in
 // this region. There are a maximum of 1024 chunks per region.
 func (r *Region) Chunks() [][2]int {
@@ -225,49 +572,82 @@ func (r *Region) HasChunk(x, z int) bool {
 // structure.
 //
 // Returns false if there is no valid chunk available, or the chunk data can
-// not be decompressed.
+// not be decompressed. Use DecodeChunk to find out why.
 func (r *Region) ReadChunk(x, z int, c *Chunk) bool {
+	return r.DecodeChunk(x, z, c) == nil
+}
+
+// DecodeChunk reads chunk data for the given coordinates into the specified
+// structure.
+//
+// Returns a *ChunkError if there is no valid chunk available, or the chunk
+// data can not be decoded. Its Err field holds ErrChunkNotFound if the
+// chunk has not been generated.
+func (r *Region) DecodeChunk(x, z int, c *Chunk) error {
 	n := chunkIndex(x, z)
 
 	if r.chunks[n] == nil {
-		return false
+		return r.chunkError(x, z, "read chunk", ErrChunkNotFound)
 	}
 
-	return r.chunks[n].Read(c)
+	err := r.load(n)
+	if err == nil {
+		err = r.chunks[n].Decode(c)
+	}
+
+	if err != nil {
+		return r.chunkError(x, z, "read chunk", err)
+	}
+
+	return nil
 }
 
 // WriteChunk writes compresses the given chunk data, so it may later be
 // persisted using Region.Save().
+//
+// Returns false if the chunk could not be encoded. Use EncodeChunk to
+// find out why.
 func (r *Region) WriteChunk(x, z int, c *Chunk) bool {
+	return r.EncodeChunk(x, z, c) == nil
+}
+
+// EncodeChunk writes compresses the given chunk data, so it may later be
+// persisted using Region.Save(). The data is compressed according to the
+// region's Scheme and CompressionLevel fields.
+//
+// Returns a *ChunkError if the chunk could not be encoded.
+func (r *Region) EncodeChunk(x, z int, c *Chunk) error {
 	n := chunkIndex(x, z)
+	cd := r.chunks[n]
 
-	if r.chunks[n] == nil {
-		r.chunks[n] = &ChunkDescriptor{
-			X:      x,
-			Z:      z,
-			scheme: ZLib,
+	if cd == nil {
+		cd = &ChunkDescriptor{
+			X: n % ChunksPerRegion,
+			Z: n / ChunksPerRegion,
 		}
 	}
 
-	return r.chunks[n].Write(c)
+	err := cd.EncodeScheme(c, r.Scheme, r.CompressionLevel)
+	if err != nil {
+		return r.chunkError(x, z, "write chunk", err)
+	}
+
+	cd.dirty = true
+	r.chunks[n] = cd
+	return nil
 }
 
 // writeHeader writes header data into the given writer.
 func writeHeader(w io.WriteSeeker, set []*ChunkDescriptor) error {
 	var locations, timestamps [sectorSize]byte
 
-	offset := 2 // Skip first two sectors for the header.
-
 	for _, cd := range set {
 		if cd == nil {
 			continue
 		}
 
-		sectors := cd.SectorCount()
-		writeOffset(locations[:], cd.X, cd.Z, offset, sectors)
+		writeOffset(locations[:], cd.X, cd.Z, cd.sector, cd.sectors)
 		writeTimestamp(timestamps[:], cd.X, cd.Z, cd.LastModified)
-
-		offset += sectors
 	}
 
 	_, err := w.Seek(0, 0)
@@ -316,60 +696,71 @@ func writeChunk(w io.WriteSeeker, cd *ChunkDescriptor, offset int) error {
 		return err
 	}
 
-	// Write compressed data size.
-	err = writeU32(w, uint32(len(cd.data)))
+	data, scheme := cd.data, cd.scheme
+
+	// Chunks too large for the region only store their compression scheme.
+	// The data itself goes into a separate file.
+	if cd.external() {
+		data, scheme = nil, scheme|externalFlag
+	}
+
+	// Write compressed data size. This includes the compression scheme.
+	err = writeU32(w, uint32(len(data)+1))
 	if err != nil {
 		return err
 	}
 
 	// Write compression scheme.
-	err = writeU8(w, ZLib)
+	err = writeU8(w, scheme)
 	if err != nil {
 		return err
 	}
 
 	// Write compressed data.
-	_, err = w.Write(cd.data)
+	_, err = w.Write(data)
 	if err != nil {
 		return err
 	}
 
 	// Pad data
-	padding := (cd.SectorCount() * sectorSize) - len(cd.data)
+	padding := (cd.SectorCount() * sectorSize) - len(data) - chunkHeaderSize
 	_, err = w.Write(make([]byte, padding))
 	return err
 }
 
-// readChunk reads a chunk from the given stream.
-func readChunk(r io.ReadSeeker, x, z, offset int, timestamps []byte) (*ChunkDescriptor, error) {
-	cd := &ChunkDescriptor{
-		X:            x,
-		Z:            z,
-		LastModified: readTimestamp(timestamps, x, z),
-	}
-
+// readChunk reads the data for a chunk from the given stream into cd.
+func readChunk(r io.ReadSeeker, cd *ChunkDescriptor, offset int) error {
 	// Jump to chunk sector.
 	_, err := r.Seek(int64(offset)*sectorSize, 0)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Read compressed data size.
+	// Read compressed data size. This includes the compression scheme.
 	size, err := readU32(r)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if size == 0 || size > maxChunkSectors*sectorSize {
+		return fmt.Errorf("invalid chunk size %d", size)
 	}
 
 	// Read compression scheme.
 	cd.scheme, err = readU8(r)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Read compressed data.
-	cd.data = make([]byte, size)
-	_, err = io.ReadFull(r, cd.data)
-	return cd, err
+	data := make([]byte, size-1)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return err
+	}
+
+	cd.data = data
+	return nil
 }
 
 // readTimestamp returns the time at which the given chunk was last modified.
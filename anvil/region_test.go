@@ -4,10 +4,14 @@
 package anvil
 
 import (
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/kpfaulkner/mctools/anvil/item"
 )
 
 type regionCoordTest struct {
@@ -182,6 +186,315 @@ func TestRegionRoundtrip(t *testing.T) {
 	}
 }
 
+func TestRegionErrors(t *testing.T) {
+	r, err := CreateRegion(filepath.Join(t.TempDir(), "r.1.-2.mca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c Chunk
+	err = r.DecodeChunk(3, 4, &c)
+
+	var ce *ChunkError
+	if !errors.As(err, &ce) || !errors.Is(err, ErrChunkNotFound) {
+		t.Fatalf("expected missing chunk error; have %v", err)
+	}
+
+	if ce.RX != 1 || ce.RZ != -2 || ce.X != 3 || ce.Z != 4 {
+		t.Fatalf("coordinate mismatch: %+v", ce)
+	}
+
+	c.Init(3, 4)
+	if err = r.EncodeChunk(3, 4, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the compressed data.
+	r.chunks[chunkIndex(3, 4)].data[0] ^= 0xff
+
+	err = r.DecodeChunk(3, 4, &c)
+	if !errors.As(err, &ce) || errors.Is(err, ErrChunkNotFound) {
+		t.Fatalf("expected decode error; have %v", err)
+	}
+
+	want := "anvil: r(1 -2) c(3 4): read chunk: "
+	if have := err.Error(); len(have) <= len(want) || have[:len(want)] != want {
+		t.Fatalf("message mismatch: %q", have)
+	}
+}
+
+func TestOpenRegion(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "r.0.0.mca")
+
+	ra, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want [2]Chunk
+	for i := range want {
+		want[i].Init(i, 5)
+		want[i].Section(i*16, true).Write(1, 2, 3, &Block{Id: item.DiamondOre})
+
+		if err = ra.EncodeChunk(i, 5, &want[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = ra.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	rb, err := OpenRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rb.Close()
+
+	if rb.ChunkLen() != 2 || rb.chunks[chunkIndex(0, 5)].data != nil {
+		t.Fatalf("expected two unread chunks")
+	}
+
+	var have Chunk
+	if err = rb.DecodeChunk(0, 5, &have); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(have, want[0]) {
+		t.Fatalf("chunk mismatch:\nHave: %+v\nWant: %+v", have, want[0])
+	}
+
+	if rb.chunks[chunkIndex(1, 5)].data != nil {
+		t.Fatalf("expected chunk c(1 5) to be unread")
+	}
+
+	rb.Close()
+
+	// Chunks read before closing remain available; others do not.
+	if err = rb.DecodeChunk(0, 5, &have); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = rb.DecodeChunk(1, 5, &have); err == nil {
+		t.Fatalf("expected error reading from closed region")
+	}
+}
+
+func TestSaveInPlace(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "r.0.0.mca")
+
+	r, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c [3]Chunk
+	for i := range c {
+		c[i].Init(i, 0)
+		c[i].Section(0, true).Write(i, 0, 0, &Block{Id: item.GoldOre})
+
+		if err = r.EncodeChunk(i, 0, &c[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	sector := func(x int) int { return r.chunks[chunkIndex(x, 0)].sector }
+	a, b := sector(0), sector(2)
+
+	// Grow the middle chunk past its current sectors, using data which
+	// does not compress well.
+	noise := make([]int32, 4096)
+	for i := range noise {
+		noise[i] = int32(i * 2654435761)
+	}
+
+	c[1].Unknown.Set("Noise", noise)
+	if err = r.EncodeChunk(1, 0, &c[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.SaveInPlace(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sector(0) != a || sector(2) != b {
+		t.Fatalf("unmodified chunks were moved")
+	}
+
+	if sector(1) <= b {
+		t.Fatalf("expected grown chunk to move past c(2 0); have sector %d", sector(1))
+	}
+
+	// Shrink it again; it should stay where it is, with the now unused
+	// sectors dropped from the end of the file.
+	moved := sector(1)
+
+	c[1].Unknown = nil
+	if err = r.EncodeChunk(1, 0, &c[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.SaveInPlace(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sector(1) != moved {
+		t.Fatalf("expected shrunk chunk to stay at sector %d; have %d", moved, sector(1))
+	}
+
+	stat, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := int64(moved+1) * sectorSize; stat.Size() != want {
+		t.Fatalf("file size mismatch: have %d, want %d", stat.Size(), want)
+	}
+
+	// A new chunk should fill the gap left behind by the moved one.
+	if err = r.EncodeChunk(3, 0, &c[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.SaveInPlace(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sector(3) != a+1 {
+		t.Fatalf("expected new chunk at sector %d; have %d", a+1, sector(3))
+	}
+
+	r, err = LoadRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range c {
+		var have Chunk
+		if err = r.DecodeChunk(i, 0, &have); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(have, c[i]) {
+			t.Fatalf("c(%d 0) mismatch:\nHave: %+v\nWant: %+v", i, have, c[i])
+		}
+	}
+}
+
+func TestExternalChunk(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "r.-1.2.mca")
+	mcc := filepath.Join(dir, "c.-30.67.mcc")
+
+	r, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the chunk with over 1MiB of data which does not compress well.
+	noise := make([]int32, 1<<19)
+	for i := range noise {
+		noise[i] = int32(i * 2654435761)
+	}
+
+	var want Chunk
+	want.Init(2, 3)
+	want.Unknown.Set("Noise", noise)
+
+	if err = r.EncodeChunk(2, 3, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := r.chunks[chunkIndex(2, 3)].sectors; n != 1 {
+		t.Fatalf("expected chunk to occupy one sector; have %d", n)
+	}
+
+	if _, err = os.Stat(mcc); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = OpenRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer r.Close()
+
+	var have Chunk
+	if err = r.DecodeChunk(2, 3, &have); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(have.Unknown, want.Unknown) {
+		t.Fatalf("external chunk mismatch")
+	}
+
+	// Once the chunk fits in the region again, the external file goes away.
+	have.Unknown = nil
+	if err = r.EncodeChunk(2, 3, &have); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.SaveInPlace(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(mcc); !os.IsNotExist(err) {
+		t.Fatalf("expected external file to be removed; have %v", err)
+	}
+}
+
+func TestRegionSchemes(t *testing.T) {
+	for _, scheme := range []byte{GZip, ZLib, Uncompressed, LZ4} {
+		file := filepath.Join(t.TempDir(), "r.0.0.mca")
+
+		r, err := CreateRegion(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want Chunk
+		want.Init(7, 9)
+		want.Section(70, true).Write(1, 2, 3, &Block{Id: item.EmeraldOre})
+
+		r.Scheme = scheme
+		if err = r.EncodeChunk(7, 9, &want); err != nil {
+			t.Fatalf("scheme %d: %v", scheme, err)
+		}
+
+		if err = r.Save(); err != nil {
+			t.Fatalf("scheme %d: %v", scheme, err)
+		}
+
+		r, err = LoadRegion(file)
+		if err != nil {
+			t.Fatalf("scheme %d: %v", scheme, err)
+		}
+
+		var have Chunk
+		if err = r.DecodeChunk(7, 9, &have); err != nil {
+			t.Fatalf("scheme %d: %v", scheme, err)
+		}
+
+		if !reflect.DeepEqual(have, want) {
+			t.Fatalf("scheme %d: chunk mismatch", scheme)
+		}
+
+		if cd := r.chunks[chunkIndex(7, 9)]; cd.scheme != scheme {
+			t.Fatalf("scheme mismatch: have %d, want %d", cd.scheme, scheme)
+		}
+	}
+}
+
 // copyFile copies file src to file dst.
 func copyFile(dst, src string) bool {
 	fs, err := os.Open(src)
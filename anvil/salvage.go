@@ -0,0 +1,86 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// QuarantineFileExtension defines the file extension for the raw data of
+// damaged chunks, as saved by SalvageRegion.
+const QuarantineFileExtension = ".damaged"
+
+// SalvageRegion opens a region from the given file and reads the data for
+// all its chunks, like LoadRegion. Unlike LoadRegion, it does not give up
+// on the first damaged chunk.
+//
+// Chunks which can not be read or decoded are left out of the region. A
+// *ChunkError is returned for each of them, along with the region holding
+// the healthy chunks. An error is only returned if the file can not be
+// read at all. Chunks stored in the wrong location are moved or left out,
+// as with RepairRegion.
+//
+// If quarantine is not empty, the raw sectors of each damaged chunk are
+// copied into that directory, as far as they lie within the file. They
+// are named 'c.<X>.<Z>.damaged', where X and Z are the absolute chunk
+// coordinates.
+//
+// Saving the region removes the damaged chunks from the file for good.
+func SalvageRegion(file, quarantine string) (*Region, []*ChunkError, error) {
+	v, err := verifyRegion(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := v.r
+	defer r.Close()
+
+	var errs []*ChunkError
+
+	for _, p := range v.problems {
+		if p.Dropped {
+			errs = append(errs, r.chunkError(p.X, p.Z, "read chunk",
+				fmt.Errorf("%s: %s", p.Kind, p.Msg)))
+		}
+	}
+
+	if len(quarantine) == 0 {
+		return r, errs, nil
+	}
+
+	for _, cd := range v.dropped {
+		err = r.quarantine(cd, quarantine)
+		if err != nil {
+			return nil, nil, r.chunkError(cd.X, cd.Z, "quarantine chunk", err)
+		}
+	}
+
+	return r, errs, nil
+}
+
+// quarantine copies the raw sectors of the given chunk into a file in dir.
+func (r *Region) quarantine(cd *ChunkDescriptor, dir string) error {
+	if cd.sector < 2 || cd.sectors == 0 {
+		return nil // Nothing sensible to copy.
+	}
+
+	if r.fd == nil {
+		return errors.New("region is closed")
+	}
+
+	x := r.X*ChunksPerRegion + cd.X
+	z := r.Z*ChunksPerRegion + cd.Z
+	name := fmt.Sprintf("c.%d.%d%s", x, z, QuarantineFileExtension)
+
+	src := io.NewSectionReader(r.fd, int64(cd.sector)*sectorSize, int64(cd.sectors)*sectorSize)
+
+	return writeFile(filepath.Join(dir, name), "", func(fd *os.File) error {
+		_, err := io.Copy(fd, src)
+		return err
+	})
+}
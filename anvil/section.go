@@ -3,25 +3,48 @@
 
 package anvil
 
-import "github.com/kpfaulkner/mctools/anvil/item"
+import (
+	"math/bits"
+	"reflect"
+
+	"github.com/kpfaulkner/mctools/anvil/item"
+	"github.com/kpfaulkner/mctools/anvil/nbt"
+)
+
+// AirState is the name of the block state for air.
+const AirState = "minecraft:air"
 
 // Section defines a section of blocks.
 //
 // Each chunk is divided up into 16 equal sections.
 // Only generated sections will be saved to the world file.
 // This is done to save file space. Each section spans 16*16*16 blocks.
+//
+// Sections come in two layouts. Worlds from before Minecraft 1.13 store
+// numeric block ids in Blocks, Add and Data. Newer worlds store a palette
+// of block states, along with the packed palette index for each block in
+// BlockStates. Read and Write handle both transparently.
 type Section struct {
-	Blocks     []uint8 `nbt:"Blocks"`        // Primary block IDs -- 8 bits per block.
-	Add        []uint8 `nbt:"Add,omitempty"` // Optional extra block ID information -- 4 bits per block.
-	Data       []uint8 `nbt:"Data"`          // Block data -- 4 bits per block.
-	BlockLight []uint8 `nbt:"BlockLight"`    // Amount of block-emitted light in each block -- 4 bits per block.
-	SkyLight   []uint8 `nbt:"SkyLight"`      // Amount of sunlight or moonlight hitting each block -- 4 bits per block.
-	Y          byte    `nbt:"Y"`             // Y index for this section.
+	Blocks      []uint8      `nbt:"Blocks,omitempty"`      // Primary block IDs -- 8 bits per block.
+	Add         []uint8      `nbt:"Add,omitempty"`         // Optional extra block ID information -- 4 bits per block.
+	Data        []uint8      `nbt:"Data,omitempty"`        // Block data -- 4 bits per block.
+	Palette     []BlockState `nbt:"Palette,omitempty"`     // Block states used in this section (1.13+).
+	BlockStates []int64      `nbt:"BlockStates,omitempty"` // Packed indices into Palette -- 4+ bits per block (1.13+).
+	BlockLight  []uint8      `nbt:"BlockLight,omitempty"`  // Amount of block-emitted light in each block -- 4 bits per block.
+	SkyLight    []uint8      `nbt:"SkyLight,omitempty"`    // Amount of sunlight or moonlight hitting each block -- 4 bits per block.
+	Y           int8         `nbt:"Y"`                     // Y index for this section; -1 for the lighting section below the world (1.14+).
+	Unknown     nbt.Compound `nbt:",remain"`               // Tags not covered by the fields above.
+
+	states []string     // Cached string representations of the palette entries.
+	ids    []item.Id    // Cached legacy ids of the palette entries.
+	cached []BlockState // Copy of the palette entries the caches were built from.
+	span   bool         // Palette indices may span two longs, as before 1.16.
 }
 
 // Init initializes the section to default, empty settings.
-func (s *Section) Init(y byte) {
-	if len(s.Blocks) > 0 {
+// This uses the numeric block layout from before Minecraft 1.13.
+func (s *Section) Init(y int8) {
+	if len(s.Blocks) > 0 || len(s.Palette) > 0 {
 		return // Already initializes.
 	}
 
@@ -38,56 +61,492 @@ func (s *Section) Init(y byte) {
 	}
 }
 
+// InitPalette initializes the section to default, empty settings.
+// This uses the palette-based block layout from Minecraft 1.13+.
+// All blocks are set to air.
+func (s *Section) InitPalette(y int8) {
+	if len(s.Blocks) > 0 || len(s.Palette) > 0 {
+		return // Already initializes.
+	}
+
+	s.Y = y
+	s.Palette = []BlockState{{Name: AirState}}
+	s.BlockStates = make([]int64, 4096*4/64)
+	s.BlockLight = make([]uint8, 2048)
+	s.SkyLight = make([]uint8, 2048)
+	s.states = nil
+	s.ids = nil
+	s.cached = nil
+
+	// Set the skylight to highest light level.
+	for i := range s.SkyLight {
+		s.SkyLight[i] = MaxLight
+	}
+}
+
+// Clone returns a copy of the section, which shares no block data with s.
+// Unknown tags are shared.
+func (s *Section) Clone() Section {
+	out := *s
+	out.Blocks = cloneBytes(s.Blocks)
+	out.Add = cloneBytes(s.Add)
+	out.Data = cloneBytes(s.Data)
+	out.BlockLight = cloneBytes(s.BlockLight)
+	out.SkyLight = cloneBytes(s.SkyLight)
+
+	if s.BlockStates != nil {
+		out.BlockStates = append(make([]int64, 0, len(s.BlockStates)), s.BlockStates...)
+	}
+
+	if s.Palette != nil {
+		out.Palette = make([]BlockState, len(s.Palette))
+		for i := range s.Palette {
+			out.Palette[i] = copyState(s.Palette[i])
+		}
+	}
+
+	// The caches are rebuilt as needed.
+	out.states = nil
+	out.ids = nil
+	out.cached = nil
+	out.cacheStates()
+	return out
+}
+
+// cloneBytes returns a copy of b, or nil if b is nil.
+func cloneBytes(b []uint8) []uint8 {
+	if b == nil {
+		return nil
+	}
+
+	return append(make([]uint8, 0, len(b)), b...)
+}
+
 // Write stores the given block struct for the specified coordinates.
 //
-// Returns false if the coordinates are out of range.
+// Legacy sections store the block's Id. Palette-based sections store
+// the block's State. If the field a section stores is not set, it is
+// converted from the other one; see item.Id.BlockState.
+//
+// If both are set and name different blocks, Id wins. A block filled in
+// by Read can thus be changed by setting its Id alone. As the zero Id is
+// also air, an Id of 0 never overrides a State; set State to AirState,
+// or clear it, to write air.
+//
+// Returns false if the coordinates are out of range, or the block can
+// not be represented in this section.
 func (s *Section) Write(x, y, z int, b *Block) bool {
 	index := y*16*16 + z*16 + x
 
-	if index < 0 || index >= len(s.Blocks) {
+	if index < 0 || index >= 4096 {
 		return false
 	}
 
-	s.Blocks[index] = uint8(b.Id)
+	if len(s.Palette) > 0 {
+		state := b.State
+		if len(state) == 0 || (b.Id != 0 && b.Id != item.Unknown && stateId(state) != b.Id) {
+			state, _ = b.Id.BlockState()
+		}
+
+		if !s.writeState(index, state) {
+			return false
+		}
+	} else {
+		if index >= len(s.Blocks) {
+			return false
+		}
 
-	if add := uint8(b.Id >> 8); add > 0 {
-		if len(s.Add) == 0 {
-			s.Add = make([]uint8, 2048)
+		id := b.Id
+		if (id == 0 || id == item.Unknown) && len(b.State) > 0 {
+			var ok bool
+			if id, ok = item.FromBlockState(b.State); !ok {
+				return false
+			}
 		}
 
-		snibble(s.Add, index, add)
+		if id == item.Unknown {
+			return false
+		}
+
+		s.Blocks[index] = uint8(id)
+
+		if add := uint8(id >> 8); add > 0 {
+			if len(s.Add) == 0 {
+				s.Add = make([]uint8, 2048)
+			}
+
+			snibble(s.Add, index, add)
+		}
+
+		snibble(s.Data, index, uint8(id>>16))
+	}
+
+	if len(s.BlockLight) == 0 && b.BlockLight > 0 {
+		s.BlockLight = make([]uint8, 2048)
+	}
+
+	if len(s.SkyLight) == 0 && b.SkyLight > 0 {
+		s.SkyLight = make([]uint8, 2048)
+	}
+
+	if len(s.BlockLight) > 0 {
+		snibble(s.BlockLight, index, b.BlockLight)
+	}
+
+	if len(s.SkyLight) > 0 {
+		snibble(s.SkyLight, index, b.SkyLight)
 	}
 
-	snibble(s.Data, index, uint8(b.Id>>16))
-	snibble(s.BlockLight, index, b.BlockLight)
-	snibble(s.SkyLight, index, b.SkyLight)
 	return true
 }
 
 // Read fills the given block struct with data at the specified coordinates.
 //
+// Both the block's Id and State are filled in. One of them is converted
+// from the other, depending on the layout of the section. Block states
+// with no legacy equivalent yield item.Unknown; legacy ids with no known
+// state yield an empty State.
+//
 // Returns false if the block data could not be found. This can happen
 // when the coordinates are out of range.
 func (s *Section) Read(x, y, z int, b *Block) bool {
 	index := y*16*16 + z*16 + x
 
-	if index < 0 || index >= len(s.Blocks) {
+	if index < 0 || index >= 4096 {
+		return false
+	}
+
+	if len(s.Palette) > 0 {
+		p, ok := s.readPalette(index)
+		if !ok {
+			return false
+		}
+
+		b.Id = s.ids[p]
+		b.State = s.states[p]
+	} else {
+		if index >= len(s.Blocks) {
+			return false
+		}
+
+		b.Id = item.Id(s.Blocks[index])
+
+		if len(s.Add) > 0 {
+			b.Id |= item.Id(gnibble(s.Add, index)) << 8
+		}
+
+		b.Id |= item.Id(gnibble(s.Data, index)) << 16
+		b.State, _ = b.Id.BlockState()
+	}
+
+	b.BlockLight = 0
+	b.SkyLight = 0
+
+	if len(s.BlockLight) > 0 {
+		b.BlockLight = gnibble(s.BlockLight, index)
+	}
+
+	if len(s.SkyLight) > 0 {
+		b.SkyLight = gnibble(s.SkyLight, index)
+	}
+
+	return true
+}
+
+// ContainsAny returns false if none of the given ids occur in the
+// section. Only primary ids are compared, as block data values can not
+// be told apart without reading each block. Block states without a legacy
+// id only match item.Unknown.
+//
+// This is much cheaper than reading all blocks and allows callers to skip
+// sections which can not hold what they are looking for. Palette-based
+// sections may report entries which are no longer used by any block.
+func (s *Section) ContainsAny(ids ...item.Id) bool {
+	if len(s.Palette) > 0 {
+		s.cacheStates()
+
+		for _, have := range s.ids {
+			if hasPrimary(ids, have.Primary()) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// Without Add data, only ids below 256 can occur.
+	var low [256]bool
+	for _, id := range ids {
+		if p := id.Primary(); p < 256 || len(s.Add) > 0 {
+			low[p&0xff] = true
+		}
+	}
+
+	for i, b := range s.Blocks {
+		if !low[b] {
+			continue
+		}
+
+		if len(s.Add) == 0 || hasPrimary(ids, int(b)|int(gnibble(s.Add, i))<<8) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasPrimary returns true if any of the given ids has primary id p.
+func hasPrimary(ids []item.Id, p int) bool {
+	for _, id := range ids {
+		if id.Primary() == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readPalette returns the palette index for the given block index.
+// The cached palette strings and ids are valid for the returned index.
+func (s *Section) readPalette(index int) (int, bool) {
+	n := s.bitsPerBlock()
+
+	if len(s.BlockStates) < s.packedLen(n, s.isSpanning(n)) {
+		return 0, false
+	}
+
+	p := s.readIndex(index, n, s.isSpanning(n))
+	if p >= len(s.Palette) {
+		return 0, false
+	}
+
+	// Only the entry being read needs to be current.
+	if len(s.cached) != len(s.Palette) || !sameState(&s.cached[p], &s.Palette[p]) {
+		s.cacheStates()
+	}
+
+	return p, true
+}
+
+// writeState sets the block state for the given block index.
+// The palette is extended as necessary.
+func (s *Section) writeState(index int, state string) bool {
+	bs, ok := ParseBlockState(state)
+	if !ok {
 		return false
 	}
 
-	b.Id = item.Id(s.Blocks[index])
+	state = bs.String()
+	s.cacheStates()
 
-	if len(s.Add) > 0 {
-		b.Id |= item.Id(gnibble(s.Add, index)) << 8
+	p := -1
+	for i := range s.states {
+		if s.states[i] == state {
+			p = i
+			break
+		}
+	}
+
+	if p == -1 {
+		old := s.bitsPerBlock()
+
+		s.Palette = append(s.Palette, bs)
+		s.states = append(s.states, state)
+		s.ids = append(s.ids, stateId(state))
+		s.cached = append(s.cached, copyState(bs))
+		p = len(s.Palette) - 1
+
+		// Widen the packed indices if the palette no longer fits.
+		if s.bitsPerBlock() != old {
+			s.repack(old)
+		}
 	}
 
-	b.Id |= item.Id(gnibble(s.Data, index)) << 16
+	n := s.bitsPerBlock()
+	span := s.isSpanning(n)
 
-	b.BlockLight = gnibble(s.BlockLight, index)
-	b.SkyLight = gnibble(s.SkyLight, index)
+	if len(s.BlockStates) < s.packedLen(n, span) {
+		return false
+	}
+
+	s.writeIndex(index, p, n, span)
 	return true
 }
 
+// repack rewrites the packed indices, which currently use the given number
+// of bits per block, to the size required by the current palette.
+func (s *Section) repack(old int) {
+	span := s.isSpanning(old)
+	n := s.bitsPerBlock()
+
+	set := make([]int, 4096)
+	if len(s.BlockStates) >= s.packedLen(old, span) {
+		for i := range set {
+			set[i] = s.readIndex(i, old, span)
+		}
+	}
+
+	s.span = span
+	s.BlockStates = make([]int64, s.packedLen(n, span))
+
+	for i, v := range set {
+		s.writeIndex(i, v, n, span)
+	}
+}
+
+// cacheStates ensures the cached palette strings and ids are up to date.
+// Palette entries which were changed in place are detected by comparing
+// them to the copy the caches were built from.
+func (s *Section) cacheStates() {
+	if len(s.cached) == len(s.Palette) {
+		current := true
+		for i := range s.Palette {
+			if !sameState(&s.cached[i], &s.Palette[i]) {
+				current = false
+				break
+			}
+		}
+
+		if current {
+			return
+		}
+	}
+
+	s.states = make([]string, len(s.Palette))
+	s.ids = make([]item.Id, len(s.Palette))
+	s.cached = make([]BlockState, len(s.Palette))
+
+	for i := range s.Palette {
+		s.states[i] = s.Palette[i].String()
+		s.ids[i] = stateId(s.states[i])
+		s.cached[i] = copyState(s.Palette[i])
+	}
+}
+
+// copyState returns a copy of bs, which does not share its properties.
+func copyState(bs BlockState) BlockState {
+	if len(bs.Properties) > 0 {
+		bs.Properties = append(nbt.Compound(nil), bs.Properties...)
+	}
+
+	return bs
+}
+
+// sameState returns true if a and b hold the same name and properties.
+func sameState(a, b *BlockState) bool {
+	if a.Name != b.Name || len(a.Properties) != len(b.Properties) {
+		return false
+	}
+
+	for i := range a.Properties {
+		pa, pb := &a.Properties[i], &b.Properties[i]
+		if pa.Name != pb.Name {
+			return false
+		}
+
+		// Properties are nearly always strings; avoid reflection for them.
+		va, ok := pa.Value.(string)
+		if vb, okb := pb.Value.(string); ok && okb {
+			if va != vb {
+				return false
+			}
+		} else if !reflect.DeepEqual(pa.Value, pb.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stateId returns the legacy id for the given block state, or
+// item.Unknown if there is none.
+func stateId(state string) item.Id {
+	id, ok := item.FromBlockState(state)
+	if !ok {
+		return item.Unknown
+	}
+
+	return id
+}
+
+// bitsPerBlock returns the number of bits used for each packed palette index.
+func (s *Section) bitsPerBlock() int {
+	n := bits.Len(uint(len(s.Palette) - 1))
+	if n < 4 {
+		return 4
+	}
+	return n
+}
+
+// isSpanning returns true if packed palette indices of the given size
+// may span two longs. Minecraft 1.16 changed this, so no index is split
+// across longs anymore. The layout in use can be inferred from the length
+// of the packed data, unless the two layouts are identical.
+func (s *Section) isSpanning(n int) bool {
+	if 64%n == 0 {
+		return s.span
+	}
+
+	return len(s.BlockStates) == s.packedLen(n, true)
+}
+
+// packedLen returns the number of longs needed to store 4096 packed palette
+// indices of the given size.
+func (s *Section) packedLen(n int, span bool) int {
+	if span {
+		return (4096*n + 63) / 64
+	}
+
+	perLong := 64 / n
+	return (4096 + perLong - 1) / perLong
+}
+
+// readIndex returns the packed palette index for the given block.
+func (s *Section) readIndex(index, n int, span bool) int {
+	mask := uint64(1)<<uint(n) - 1
+
+	if !span {
+		perLong := 64 / n
+		v := uint64(s.BlockStates[index/perLong])
+		return int((v >> uint((index%perLong)*n)) & mask)
+	}
+
+	bit := index * n
+	word, offset := bit/64, uint(bit%64)
+	v := uint64(s.BlockStates[word]) >> offset
+
+	if offset+uint(n) > 64 {
+		v |= uint64(s.BlockStates[word+1]) << (64 - offset)
+	}
+
+	return int(v & mask)
+}
+
+// writeIndex sets the packed palette index for the given block.
+func (s *Section) writeIndex(index, value, n int, span bool) {
+	mask := uint64(1)<<uint(n) - 1
+	v := uint64(value) & mask
+
+	if !span {
+		perLong := 64 / n
+		word, offset := index/perLong, uint((index%perLong)*n)
+		w := uint64(s.BlockStates[word])
+		s.BlockStates[word] = int64(w&^(mask<<offset) | v<<offset)
+		return
+	}
+
+	bit := index * n
+	word, offset := bit/64, uint(bit%64)
+	w := uint64(s.BlockStates[word])
+	s.BlockStates[word] = int64(w&^(mask<<offset) | v<<offset)
+
+	if offset+uint(n) > 64 {
+		shift := 64 - offset
+		w = uint64(s.BlockStates[word+1])
+		s.BlockStates[word+1] = int64(w&^(mask>>shift) | v>>shift)
+	}
+}
+
 // gnibble returns either upper or lower 4-bits for a given index.
 func gnibble(arr []uint8, index int) uint8 {
 	if index%2 == 0 {
@@ -0,0 +1,251 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kpfaulkner/mctools/anvil/item"
+)
+
+func TestSectionLegacy(t *testing.T) {
+	var s Section
+	s.Init(0)
+
+	want := Block{Id: item.Granite, State: "minecraft:granite", BlockLight: 3, SkyLight: 7}
+	if !s.Write(1, 2, 3, &Block{Id: item.Granite, BlockLight: 3, SkyLight: 7}) {
+		t.Fatalf("write failed")
+	}
+
+	var have Block
+	if !s.Read(1, 2, 3, &have) {
+		t.Fatalf("read failed")
+	}
+
+	if have != want {
+		t.Fatalf("block mismatch:\nHave: %+v\nWant: %+v", have, want)
+	}
+}
+
+func TestSectionPalette(t *testing.T) {
+	for _, span := range []bool{false, true} {
+		var s Section
+		s.InitPalette(0)
+		s.span = span
+
+		// Write enough distinct states to force the packed indices
+		// to grow from 4 to 6 bits.
+		for i := 0; i < 4096; i++ {
+			b := Block{State: fmt.Sprintf("test:block%d", i%40)}
+			if !s.Write(i%16, i/256, (i/16)%16, &b) {
+				t.Fatalf("span=%v: write %d failed", span, i)
+			}
+		}
+
+		if n := s.bitsPerBlock(); n != 6 {
+			t.Fatalf("span=%v: expected 6 bits per block; have %d", span, n)
+		}
+
+		// A fresh section with the same data should detect the layout.
+		c := Section{Palette: s.Palette, BlockStates: s.BlockStates}
+
+		var b Block
+		for i := 0; i < 4096; i++ {
+			want := fmt.Sprintf("test:block%d", i%40)
+
+			if !c.Read(i%16, i/256, (i/16)%16, &b) {
+				t.Fatalf("span=%v: read %d failed", span, i)
+			}
+
+			if b.State != want {
+				t.Fatalf("span=%v: block %d mismatch:\nHave: %s\nWant: %s", span, i, b.State, want)
+			}
+		}
+	}
+}
+
+func TestSectionConvert(t *testing.T) {
+	var a, b Section
+	a.Init(0)
+	b.InitPalette(0)
+
+	for i, v := range []struct {
+		Id    item.Id
+		State string
+	}{
+		{item.Air, "minecraft:air"},
+		{item.Granite, "minecraft:granite"},
+		{item.Oak4Log, "minecraft:oak_log[axis=x]"},
+		{item.RedstoneOreGlowing, "minecraft:redstone_ore[lit=true]"},
+		{item.WoodDoubleSlab, "minecraft:petrified_oak_slab[type=double]"},
+	} {
+		// Legacy sections store ids; palette sections store states.
+		// Each should accept and yield the other as well.
+		if !a.Write(i, 0, 0, &Block{State: v.State}) || !b.Write(i, 0, 0, &Block{Id: v.Id}) {
+			t.Fatalf("%v: write failed", v.Id)
+		}
+
+		for _, s := range []*Section{&a, &b} {
+			var have Block
+			if !s.Read(i, 0, 0, &have) {
+				t.Fatalf("%v: read failed", v.Id)
+			}
+
+			if have.Id != v.Id || have.State != v.State {
+				t.Fatalf("%v: mismatch:\nHave: %v %s\nWant: %v %s", v.Id, have.Id, have.State, v.Id, v.State)
+			}
+		}
+	}
+
+	// States with properties not in the table fall back to the block name.
+	if id, ok := item.FromBlockState("spruce_log[axis=z]"); !ok || id != item.SpruceLog {
+		t.Fatalf("fallback mismatch: %v %v", id, ok)
+	}
+
+	// Sub-ids holding block data fall back to the primary id.
+	if state, ok := item.NewId(53, 3).BlockState(); !ok || state != "minecraft:oak_stairs" {
+		t.Fatalf("fallback mismatch: %q %v", state, ok)
+	}
+}
+
+func TestSectionContainsAny(t *testing.T) {
+	var legacy, palette Section
+	legacy.Init(0)
+	palette.InitPalette(0)
+
+	for _, s := range []*Section{&legacy, &palette} {
+		if s.ContainsAny(item.GoldOre) {
+			t.Fatalf("empty section should not contain %v", item.GoldOre)
+		}
+
+		s.Write(15, 15, 15, &Block{Id: item.GoldOre})
+
+		if !s.ContainsAny(item.DiamondOre, item.GoldOre) {
+			t.Fatalf("section should contain %v", item.GoldOre)
+		}
+
+		if s.ContainsAny(item.DiamondOre) {
+			t.Fatalf("section should not contain %v", item.DiamondOre)
+		}
+	}
+}
+
+func TestSectionUnknownState(t *testing.T) {
+	s := Section{
+		Palette:     []BlockState{{Name: "mymod:thing"}},
+		BlockStates: make([]int64, 4096*4/64),
+	}
+
+	var b Block
+	if !s.Read(1, 2, 3, &b) {
+		t.Fatalf("read failed")
+	}
+
+	if b.Id != item.Unknown || b.State != "mymod:thing" {
+		t.Fatalf("block mismatch: %v %q", b.Id, b.State)
+	}
+
+	if s.ContainsAny(item.Air) {
+		t.Fatalf("section should not contain %v", item.Air)
+	}
+
+	if !s.ContainsAny(item.Unknown) {
+		t.Fatalf("section should contain %v", item.Unknown)
+	}
+
+	var legacy Section
+	legacy.Init(0)
+
+	if legacy.Write(1, 2, 3, &b) {
+		t.Fatalf("unknown block should not be written to legacy section")
+	}
+}
+
+func TestSectionPaletteChange(t *testing.T) {
+	var s Section
+	s.InitPalette(0)
+
+	if !s.Write(1, 2, 3, &Block{State: "minecraft:stone"}) {
+		t.Fatalf("write failed")
+	}
+
+	var b Block
+	if !s.Read(1, 2, 3, &b) || b.Id != item.Stone {
+		t.Fatalf("block mismatch: %v %q", b.Id, b.State)
+	}
+
+	// Changing a palette entry in place changes all blocks using it.
+	s.Palette[1] = BlockState{Name: "minecraft:granite"}
+
+	if !s.Read(1, 2, 3, &b) || b.Id != item.Granite || b.State != "minecraft:granite" {
+		t.Fatalf("block mismatch after palette change: %v %q", b.Id, b.State)
+	}
+
+	s.Palette[1].Name = "minecraft:dirt"
+
+	if !s.ContainsAny(item.Dirt) || s.ContainsAny(item.Granite) {
+		t.Fatalf("ContainsAny does not reflect palette change")
+	}
+}
+
+func TestSectionChangeId(t *testing.T) {
+	var legacy, palette Section
+	legacy.Init(0)
+	palette.InitPalette(0)
+
+	for _, s := range []*Section{&legacy, &palette} {
+		if !s.Write(1, 2, 3, &Block{State: "minecraft:oak_log[axis=x]"}) {
+			t.Fatalf("write failed")
+		}
+
+		// Read, change the Id and write back.
+		var b Block
+		if !s.Read(1, 2, 3, &b) {
+			t.Fatalf("read failed")
+		}
+
+		b.Id = item.Granite
+		if !s.Write(1, 2, 3, &b) {
+			t.Fatalf("write failed")
+		}
+
+		if !s.Read(1, 2, 3, &b) || b.Id != item.Granite || b.State != "minecraft:granite" {
+			t.Fatalf("block mismatch: %v %q", b.Id, b.State)
+		}
+
+		// A State naming the same block as Id is kept as is.
+		if !s.Write(1, 2, 3, &Block{Id: item.Stone, State: "minecraft:stone"}) {
+			t.Fatalf("write failed")
+		}
+
+		if !s.Read(1, 2, 3, &b) || b.Id != item.Stone {
+			t.Fatalf("block mismatch: %v %q", b.Id, b.State)
+		}
+	}
+}
+
+func TestParseBlockState(t *testing.T) {
+	for _, v := range []struct {
+		In, Out string
+		Ok      bool
+	}{
+		{"", "", false},
+		{"[axis=y]", "", false},
+		{"stone", "minecraft:stone", true},
+		{"minecraft:oak_log[axis=y]", "minecraft:oak_log[axis=y]", true},
+		{"oak_stairs[half=top,facing=east]", "minecraft:oak_stairs[facing=east,half=top]", true},
+		{"minecraft:oak_log[axis]", "", false},
+		{"minecraft:oak_log[axis=y", "", false},
+	} {
+		bs, ok := ParseBlockState(v.In)
+		if ok != v.Ok {
+			t.Fatalf("%q: success mismatch:\nHave: %v\nWant: %v", v.In, ok, v.Ok)
+		}
+
+		if ok && bs.String() != v.Out {
+			t.Fatalf("%q: mismatch:\nHave: %s\nWant: %s", v.In, bs, v.Out)
+		}
+	}
+}
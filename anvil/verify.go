@@ -0,0 +1,316 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/kpfaulkner/mctools/anvil/nbt"
+)
+
+// ProblemKind identifies a type of problem found by VerifyRegion.
+type ProblemKind int
+
+// Known problem kinds.
+const (
+	ProblemHeader   ProblemKind = iota // Chunk location points into the region header.
+	ProblemEOF                         // Chunk sectors lie beyond the end of the file.
+	ProblemOverlap                     // Chunk sectors overlap those of another chunk.
+	ProblemLength                      // Data length exceeds the chunk's sector count.
+	ProblemScheme                      // Unknown compression scheme.
+	ProblemData                        // Data can not be read, decompressed or decoded.
+	ProblemPosition                    // Chunk coordinates do not match its location.
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemHeader:
+		return "header"
+	case ProblemEOF:
+		return "eof"
+	case ProblemOverlap:
+		return "overlap"
+	case ProblemLength:
+		return "length"
+	case ProblemScheme:
+		return "scheme"
+	case ProblemData:
+		return "data"
+	case ProblemPosition:
+		return "position"
+	}
+
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// Problem describes a single problem found in a region file.
+type Problem struct {
+	Kind    ProblemKind
+	X, Z    int    // Chunk coordinates in the region.
+	Dropped bool   // The chunk is unusable and is left out by RepairRegion and SalvageRegion.
+	Msg     string // Description of the problem.
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("c(%d %d): %s: %s", p.X, p.Z, p.Kind, p.Msg)
+}
+
+// VerifyRegion checks the structure of the given region file and the data
+// of all its chunks. It returns the list of problems found.
+//
+// An error is returned if the file can not be read at all.
+func VerifyRegion(file string) ([]Problem, error) {
+	v, err := verifyRegion(file)
+	if err != nil {
+		return nil, err
+	}
+
+	v.r.Close()
+	return v.problems, nil
+}
+
+// RepairRegion checks the given region file, like VerifyRegion, and
+// rewrites it.
+//
+// Unusable chunks are left out. Chunks stored in the wrong location are
+// moved to the location matching their coordinates, provided it lies in
+// this region and is not taken by another chunk. Otherwise they are left
+// out as well, and their problem is marked as dropped. External files
+// left behind by moved chunks are removed.
+//
+// The file is rewritten even if no problems are found. The remaining
+// chunks are stored back to back, which removes any unused space from
+// the file. The previous version of the file is kept with
+// RegionBackupSuffix appended to its name.
+func RepairRegion(file string) ([]Problem, error) {
+	v, err := verifyRegion(file)
+	if err != nil {
+		return nil, err
+	}
+
+	r := v.r
+	defer r.Close()
+
+	err = r.SaveWithBackup()
+	if err != nil {
+		return v.problems, err
+	}
+
+	// Chunks which took the place of a moved chunk have already replaced
+	// or removed its external file.
+	for n := range r.chunks {
+		if to, ok := v.moves[n]; !ok || to < 0 || r.chunks[n] != nil {
+			continue
+		}
+
+		cd := &ChunkDescriptor{X: n % ChunksPerRegion, Z: n / ChunksPerRegion}
+
+		err = r.removeExternal(cd)
+		if err != nil {
+			return v.problems, r.chunkError(cd.X, cd.Z, "move chunk", err)
+		}
+	}
+
+	return v.problems, nil
+}
+
+// verification holds the results of verifyRegion.
+type verification struct {
+	r        *Region            // Region holding the usable chunks, fully loaded.
+	problems []Problem          // Problems found.
+	dropped  []*ChunkDescriptor // Unusable chunks, removed from r.
+	moves    map[int]int        // Chunk indices of misplaced chunks and their new location; -1 if they can not be moved.
+}
+
+// verifyRegion checks the given region file. Unusable chunks are removed
+// from the returned region, and misplaced chunks are moved; see
+// moveChunks.
+func verifyRegion(file string) (*verification, error) {
+	r, err := OpenRegion(file)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := r.fd.Stat()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("anvil: r(%d %d): %v", r.X, r.Z, err)
+	}
+
+	v := &verification{r: r, moves: make(map[int]int)}
+	size := int((stat.Size() + sectorSize - 1) / sectorSize)
+	owners := make([]*ChunkDescriptor, size)
+
+	for n, cd := range r.chunks {
+		if cd == nil {
+			continue
+		}
+
+		kind, msg := v.verifyChunk(cd, owners)
+		if len(msg) == 0 {
+			continue
+		}
+
+		v.problems = append(v.problems, Problem{
+			Kind:    kind,
+			X:       cd.X,
+			Z:       cd.Z,
+			Dropped: true,
+			Msg:     msg,
+		})
+
+		v.dropped = append(v.dropped, cd)
+		r.chunks[n] = nil
+	}
+
+	v.moveChunks()
+	return v, nil
+}
+
+// moveChunks moves misplaced chunks to the location matching their
+// coordinates. Moved chunks are marked dirty, so saving the region writes
+// them out. Chunks which belong outside the region, or whose location is
+// taken by another chunk, are removed from the region and added to the
+// dropped chunks; their problems are marked as dropped.
+//
+// All misplaced chunks are taken out first, so they can swap places.
+// Moves are then resolved in order of chunk index.
+func (v *verification) moveChunks() {
+	r := v.r
+
+	from := make([]int, 0, len(v.moves))
+	moving := make(map[int]*ChunkDescriptor, len(v.moves))
+
+	for n := range v.moves {
+		from = append(from, n)
+		moving[n] = r.chunks[n]
+		r.chunks[n] = nil
+	}
+
+	sort.Ints(from)
+
+	for _, n := range from {
+		cd := moving[n]
+
+		if to := v.moves[n]; to >= 0 && r.chunks[to] == nil {
+			cd.X = to % ChunksPerRegion
+			cd.Z = to / ChunksPerRegion
+			cd.dirty = true
+			r.chunks[to] = cd
+			continue
+		}
+
+		v.moves[n] = -1
+		v.dropped = append(v.dropped, cd)
+
+		for i := range v.problems {
+			p := &v.problems[i]
+			if p.Kind == ProblemPosition && chunkIndex(p.X, p.Z) == n {
+				p.Dropped = true
+			}
+		}
+	}
+}
+
+// verifyChunk checks a single chunk and reads its data. Non-fatal problems
+// are recorded directly. If the chunk is unusable, this returns the kind
+// and description of the problem.
+func (v *verification) verifyChunk(cd *ChunkDescriptor, owners []*ChunkDescriptor) (ProblemKind, string) {
+	r := v.r
+
+	report := func(kind ProblemKind, format string, argv ...interface{}) {
+		v.problems = append(v.problems, Problem{
+			Kind: kind,
+			X:    cd.X,
+			Z:    cd.Z,
+			Msg:  fmt.Sprintf(format, argv...),
+		})
+	}
+
+	if cd.sector < 2 {
+		return ProblemHeader, fmt.Sprintf("sector %d lies in the header", cd.sector)
+	}
+
+	if cd.sector+cd.sectors > len(owners) {
+		return ProblemEOF, fmt.Sprintf("sectors %d-%d lie beyond the end of the file (%d sectors)",
+			cd.sector, cd.sector+cd.sectors-1, len(owners))
+	}
+
+	for i := cd.sector; i < cd.sector+cd.sectors; i++ {
+		if o := owners[i]; o != nil {
+			report(ProblemOverlap, "sector %d is shared with c(%d %d)", i, o.X, o.Z)
+			break
+		}
+	}
+
+	for i := cd.sector; i < cd.sector+cd.sectors; i++ {
+		owners[i] = cd
+	}
+
+	err := readChunk(r.fd, cd, cd.sector)
+	if err != nil {
+		return ProblemData, fmt.Sprintf("read: %v", err)
+	}
+
+	if cd.scheme&externalFlag != 0 {
+		cd.scheme &^= externalFlag
+		cd.data, err = ioutil.ReadFile(r.externalFile(cd))
+		if err != nil {
+			return ProblemData, fmt.Sprintf("read external file: %v", err)
+		}
+	} else if n := len(cd.data) + chunkHeaderSize; n > cd.sectors*sectorSize {
+		report(ProblemLength, "%d bytes exceed %d sectors", n, cd.sectors)
+	}
+
+	if cd.scheme < GZip || cd.scheme > LZ4 {
+		return ProblemScheme, fmt.Sprintf("unknown compression scheme %d", cd.scheme)
+	}
+
+	data, err := Decompress(cd.scheme, cd.data)
+	if err != nil {
+		return ProblemData, fmt.Sprintf("decompress: %v", err)
+	}
+
+	// Decode only the coordinates. This still parses all NBT data.
+	var pos struct {
+		DataVersion int32
+		X           int32 `nbt:"xPos"`
+		Z           int32 `nbt:"zPos"`
+		Level       struct {
+			X int32 `nbt:"xPos"`
+			Z int32 `nbt:"zPos"`
+		}
+	}
+
+	err = nbt.Unmarshal(bytes.NewReader(data), &pos)
+	if err != nil {
+		return ProblemData, fmt.Sprintf("decode: %v", err)
+	}
+
+	x, z := int(pos.Level.X), int(pos.Level.Z)
+	if pos.DataVersion >= DataVersionNoLevel {
+		x, z = int(pos.X), int(pos.Z)
+	}
+
+	wx := r.X*ChunksPerRegion + cd.X
+	wz := r.Z*ChunksPerRegion + cd.Z
+
+	if x != wx || z != wz {
+		report(ProblemPosition, "chunk data is for c(%d %d), not c(%d %d)", x, z, wx, wz)
+
+		to := -1
+		lx, lz := x-r.X*ChunksPerRegion, z-r.Z*ChunksPerRegion
+
+		if lx >= 0 && lx < ChunksPerRegion && lz >= 0 && lz < ChunksPerRegion {
+			to = chunkIndex(lx, lz)
+		}
+
+		v.moves[chunkIndex(cd.X, cd.Z)] = to
+	}
+
+	return 0, ""
+}
@@ -0,0 +1,371 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package anvil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyRegion(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "r.0.0.mca")
+
+	r, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Chunk c(4 4) claims to be c(5 5). All others are fine, for now.
+	for _, xz := range [][4]int{{0, 0, 0, 0}, {1, 0, 1, 0}, {2, 0, 2, 0}, {3, 0, 3, 0}, {4, 4, 5, 5}} {
+		var c Chunk
+		c.Init(xz[2], xz[3])
+
+		if err = r.EncodeChunk(xz[0], xz[1], &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	fd, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// c(1 0): unknown compression scheme.
+	// c(2 0): garbage data.
+	// c(3 0): location beyond the end of the file.
+	fd.WriteAt([]byte{9}, int64(r.chunks[chunkIndex(1, 0)].sector)*sectorSize+4)
+	fd.WriteAt([]byte("garbage"), int64(r.chunks[chunkIndex(2, 0)].sector)*sectorSize+5)
+	fd.WriteAt([]byte{0, 1, 0, 1}, int64(chunkIndex(3, 0))*4)
+	fd.Close()
+
+	problems, err := VerifyRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Problem{
+		{Kind: ProblemScheme, X: 1, Z: 0, Dropped: true},
+		{Kind: ProblemData, X: 2, Z: 0, Dropped: true},
+		{Kind: ProblemEOF, X: 3, Z: 0, Dropped: true},
+		{Kind: ProblemPosition, X: 4, Z: 4},
+	}
+
+	if len(problems) != len(want) {
+		t.Fatalf("problem count mismatch: %v", problems)
+	}
+
+	for i := range want {
+		have := problems[i]
+		have.Msg = ""
+
+		if have != want[i] {
+			t.Fatalf("problem %d mismatch:\nHave: %v\nWant: %v", i, problems[i], want[i])
+		}
+	}
+
+	if _, err = RepairRegion(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if problems, err = VerifyRegion(file); err != nil || len(problems) > 0 {
+		t.Fatalf("unexpected problems after repair: %v %v", problems, err)
+	}
+
+	r, err = LoadRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := r.Chunks(), [][2]int{{0, 0}, {5, 5}}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("chunk list mismatch:\nHave: %v\nWant: %v", have, want)
+	}
+
+	if _, err = os.Stat(file + RegionBackupSuffix); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepairRegionMoves(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "r.0.0.mca")
+
+	r, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// c(1 0) belongs in another region, c(2 0) in the place of c(3 0),
+	// and c(4 0) in the free place of c(5 0).
+	for _, xz := range [][4]int{{0, 0, 0, 0}, {1, 0, 40, 0}, {2, 0, 3, 0}, {3, 0, 3, 0}, {4, 0, 5, 0}} {
+		var c Chunk
+		c.Init(xz[2], xz[3])
+
+		if err = r.EncodeChunk(xz[0], xz[1], &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Problem{
+		{Kind: ProblemPosition, X: 1, Z: 0, Dropped: true},
+		{Kind: ProblemPosition, X: 2, Z: 0, Dropped: true},
+		{Kind: ProblemPosition, X: 4, Z: 0},
+	}
+
+	for _, fn := range []func(string) ([]Problem, error){VerifyRegion, RepairRegion} {
+		problems, err := fn(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(problems) != len(want) {
+			t.Fatalf("problem count mismatch: %v", problems)
+		}
+
+		for i := range want {
+			have := problems[i]
+			have.Msg = ""
+
+			if have != want[i] {
+				t.Fatalf("problem %d mismatch:\nHave: %+v\nWant: %+v", i, have, want[i])
+			}
+		}
+	}
+
+	r, err = LoadRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := r.Chunks(), [][2]int{{0, 0}, {3, 0}, {5, 0}}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("chunk list mismatch:\nHave: %v\nWant: %v", have, want)
+	}
+}
+
+func TestSalvageRegion(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "r.1.0.mca")
+
+	r, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 0; x < 3; x++ {
+		var c Chunk
+		c.Init(32+x, 0)
+
+		if err = r.EncodeChunk(x, 0, &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Damage c(1 0).
+	fd, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fd.WriteAt([]byte("garbage"), int64(r.chunks[chunkIndex(1, 0)].sector)*sectorSize+5)
+	fd.Close()
+
+	r, errs, err := SalvageRegion(file, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 1 || errs[0].X != 1 || errs[0].Z != 0 || errs[0].RX != 1 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if have, want := r.Chunks(), [][2]int{{0, 0}, {2, 0}}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("chunk list mismatch:\nHave: %v\nWant: %v", have, want)
+	}
+
+	var c Chunk
+	if err = r.DecodeChunk(2, 0, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat(filepath.Join(dir, "c.33.0"+QuarantineFileExtension))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stat.Size() != sectorSize {
+		t.Fatalf("quarantined size mismatch: %d", stat.Size())
+	}
+}
+
+func TestSalvageRegionMoves(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "r.0.0.mca")
+
+	r, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// c(1 0) belongs in the place of c(2 0), which is taken, and c(3 0)
+	// in the free place of c(4 0).
+	for _, xz := range [][4]int{{0, 0, 0, 0}, {1, 0, 2, 0}, {2, 0, 2, 0}, {3, 0, 4, 0}} {
+		var c Chunk
+		c.Init(xz[2], xz[3])
+
+		if err = r.EncodeChunk(xz[0], xz[1], &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, errs, err := SalvageRegion(file, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 1 || errs[0].X != 1 || errs[0].Z != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if have, want := r.Chunks(), [][2]int{{0, 0}, {2, 0}, {4, 0}}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("chunk list mismatch:\nHave: %v\nWant: %v", have, want)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "c.1.0"+QuarantineFileExtension)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if problems, err := VerifyRegion(file); err != nil || len(problems) > 0 {
+		t.Fatalf("unexpected problems after salvage: %v %v", problems, err)
+	}
+}
+
+func TestRepairRegionCompact(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "r.0.0.mca")
+
+	r, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 0; x < 2; x++ {
+		var c Chunk
+		c.Init(x, 0)
+
+		if err = r.EncodeChunk(x, 0, &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Growing c(0 0) moves it to the end of the file, leaving a gap.
+	var c Chunk
+	c.Init(0, 0)
+	c.Unknown.Set("Noise", make([]int8, 3*sectorSize))
+
+	r.Scheme = Uncompressed
+	if err = r.EncodeChunk(0, 0, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.SaveInPlace(); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := RepairRegion(file)
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("unexpected problems: %v %v", problems, err)
+	}
+
+	after, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Size() >= before.Size() {
+		t.Fatalf("file was not compacted: %d bytes before, %d after", before.Size(), after.Size())
+	}
+
+	if _, err = LoadRegion(file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepairRegionExternal(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "r.0.0.mca")
+
+	r, err := CreateRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the chunk with over 1MiB of data which does not compress well,
+	// so it is stored in an external file.
+	noise := make([]int32, 1<<19)
+	for i := range noise {
+		noise[i] = int32(i * 2654435761)
+	}
+
+	// c(1 0) belongs in the place of c(5 0).
+	var c Chunk
+	c.Init(5, 0)
+	c.Unknown.Set("Noise", noise)
+
+	if err = r.EncodeChunk(1, 0, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = RepairRegion(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "c.1.0"+ExternalFileExtension)); !os.IsNotExist(err) {
+		t.Fatalf("expected old external file to be removed; have %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "c.5.0"+ExternalFileExtension)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = LoadRegion(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := r.Chunks(), [][2]int{{5, 0}}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("chunk list mismatch:\nHave: %v\nWant: %v", have, want)
+	}
+}
@@ -0,0 +1,95 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mctools
+
+import (
+	"fmt"
+
+	"github.com/kpfaulkner/mctools/anvil"
+)
+
+// ErrChunkNotFound is returned when accessing blocks in a chunk which has
+// not been generated yet.
+var ErrChunkNotFound = anvil.ErrChunkNotFound
+
+// Block returns the block at the given absolute coordinates in the
+// specified dimension.
+//
+// The region and chunk holding the block are loaded as necessary, and
+// kept around for subsequent calls. Blocks in sections which have not
+// been generated yet are air. Returns ErrChunkNotFound if the chunk does
+// not exist.
+func (w *World) Block(dim string, x, y, z int) (anvil.Block, error) {
+	var b anvil.Block
+
+	if y < 0 || y >= anvil.MaxChunkHeight {
+		return b, fmt.Errorf("mctools: block y coordinate %d out of range", y)
+	}
+
+	cx, cz := ChunkCoords(x, z)
+
+	c, err := w.lockChunk(dim, cx, cz)
+	if err != nil {
+		return b, err
+	}
+
+	defer w.cache.mu.Unlock()
+
+	bx, by, bz := BlockCoords(x, y, z)
+
+	s := c.chunk.Section(by, false)
+	if s == nil {
+		b.State = anvil.AirState
+		b.SkyLight = anvil.MaxLight
+		return b, nil
+	}
+
+	if !s.Read(bx, by%anvil.BlocksPerSection, bz, &b) {
+		return b, fmt.Errorf("mctools: block (%d %d %d) can not be read", x, y, z)
+	}
+
+	return b, nil
+}
+
+// SetBlock sets the block at the given absolute coordinates in the
+// specified dimension.
+//
+// The region and chunk holding the block are loaded as necessary. The
+// change is kept in memory until Flush is called, or the chunk is evicted
+// from the world's cache. Returns ErrChunkNotFound if the chunk does not
+// exist.
+//
+// The block's Id and State are combined as with anvil.Section.Write: a
+// block returned by Block can be changed by setting its Id alone.
+//
+// Block, SetBlock, Chunk, RegionChunks and Flush may be called from
+// multiple goroutines. Chunks returned by Chunk earlier are not changed
+// by SetBlock; see Chunk.
+func (w *World) SetBlock(dim string, x, y, z int, b anvil.Block) error {
+	if y < 0 || y >= anvil.MaxChunkHeight {
+		return fmt.Errorf("mctools: block y coordinate %d out of range", y)
+	}
+
+	cx, cz := ChunkCoords(x, z)
+
+	c, err := w.lockChunk(dim, cx, cz)
+	if err != nil {
+		return err
+	}
+
+	defer w.cache.mu.Unlock()
+
+	w.own(c)
+
+	bx, by, bz := BlockCoords(x, y, z)
+
+	s := c.chunk.Section(by, true)
+	if s == nil || !s.Write(bx, by%anvil.BlocksPerSection, bz, &b) {
+		return fmt.Errorf("mctools: block (%d %d %d) can not be written", x, y, z)
+	}
+
+	c.dirty = true
+	w.resize(c)
+	return w.trim(c)
+}
@@ -0,0 +1,139 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mctools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kpfaulkner/mctools/anvil"
+	"github.com/kpfaulkner/mctools/anvil/item"
+)
+
+// testWorld creates a world in a temporary directory, with empty chunks
+// at -1,-1 and -2,-1 in region -1,-1 and at 0,0 in region 0,0.
+func testWorld(t *testing.T) *World {
+	root := t.TempDir()
+
+	data, err := ioutil.ReadFile("testdata/newworld/level.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(root, "level.dat"), data, 0644)
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(root, DimensionOverworld), 0755)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regions := []struct {
+		x, z   int
+		chunks [][2]int
+	}{
+		{-1, -1, [][2]int{{-1, -1}, {-2, -1}}},
+		{0, 0, [][2]int{{0, 0}}},
+	}
+
+	for _, tr := range regions {
+		r, err := w.CreateRegion(DimensionOverworld, tr.x, tr.z)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, xz := range tr.chunks {
+			var c anvil.Chunk
+			c.Init(xz[0], xz[1])
+
+			if err = r.EncodeChunk(xz[0], xz[1], &c); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err = r.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return w
+}
+
+func TestWorldBlock(t *testing.T) {
+	w := testWorld(t)
+	defer w.Close()
+
+	b, err := w.Block(DimensionOverworld, -3, 70, -5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.State != anvil.AirState || b.SkyLight != anvil.MaxLight {
+		t.Fatalf("block mismatch: want air; have %+v", b)
+	}
+
+	err = w.SetBlock(DimensionOverworld, -3, 70, -5, anvil.Block{Id: item.GoldOre})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = Open(w.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = w.Block(DimensionOverworld, -3, 70, -5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Id != item.GoldOre {
+		t.Fatalf("block mismatch: want %v; have %v", item.GoldOre, b.Id)
+	}
+}
+
+func TestWorldBlockErrors(t *testing.T) {
+	w := testWorld(t)
+	defer w.Close()
+
+	tests := []struct {
+		x, y, z int
+	}{
+		{-3, -1, -5},
+		{-3, anvil.MaxChunkHeight, -5},
+		{600, 70, 600}, // Region does not exist.
+		{-30, 70, -30}, // Chunk does not exist.
+	}
+
+	for _, tt := range tests {
+		_, err := w.Block(DimensionOverworld, tt.x, tt.y, tt.z)
+		if err == nil {
+			t.Fatalf("expected error for block (%d %d %d)", tt.x, tt.y, tt.z)
+		}
+
+		if err = w.SetBlock(DimensionOverworld, tt.x, tt.y, tt.z, anvil.Block{}); err == nil {
+			t.Fatalf("expected error for block (%d %d %d)", tt.x, tt.y, tt.z)
+		}
+	}
+
+	if _, err := w.Block(DimensionOverworld, 600, 70, 600); err != ErrChunkNotFound {
+		t.Fatalf("error mismatch: want %v; have %v", ErrChunkNotFound, err)
+	}
+}
@@ -0,0 +1,584 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mctools
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kpfaulkner/mctools/anvil"
+	"github.com/kpfaulkner/mctools/anvil/nbt"
+)
+
+// Default cache limits for a World. A decoded chunk takes roughly
+// 100-200KiB of memory, depending on the number of sections it holds.
+// Open regions hold the compressed data of the chunks read from them.
+const (
+	DefaultMaxMemory  = 256 << 20
+	DefaultMaxRegions = 16
+)
+
+// Estimated memory use of the parts of a chunk which are not measured
+// directly, in bytes.
+const (
+	chunkOverhead   = 1024
+	sectionOverhead = 256
+	paletteSize     = 128 // Palette entry, along with its cached state and id.
+	entitySize      = 512
+)
+
+// regionKey identifies a region in a specific dimension.
+type regionKey struct {
+	dim  string
+	x, z int
+}
+
+// chunkKey identifies a chunk in a specific dimension, by its absolute
+// chunk coordinates.
+type chunkKey struct {
+	dim  string
+	x, z int
+}
+
+// worldRegion is an open region held by a World.
+type worldRegion struct {
+	*anvil.Region
+	mu      sync.Mutex // Serializes access to the region.
+	key     regionKey
+	changed bool  // Region holds encoded chunks which have not been saved.
+	users   int   // Number of chunks being decoded; the region is not evicted while in use.
+	size    int64 // Compressed chunk data held in memory.
+}
+
+// worldChunk is a decoded chunk held by a World.
+type worldChunk struct {
+	chunk  *anvil.Chunk
+	key    chunkKey
+	region *worldRegion // Region holding the chunk.
+	size   int64        // Estimated memory use.
+	dirty  bool         // Chunk has been changed since it was loaded or flushed.
+	shared bool         // Chunk has been returned by World.Chunk; copy it before changing it.
+}
+
+// cache holds the regions and decoded chunks of a World, each in least
+// recently used order. Chunks, and then regions, are evicted when their
+// estimated memory use grows past its limit; regions also when there are
+// too many of them. Changed chunks are written back to their region on
+// eviction and changed regions are saved before being closed.
+//
+// The cache is safe for concurrent use. Chunks are decoded without holding
+// its lock, so concurrent scans of different regions do not wait for each
+// other. Chunks handed out by World.Chunk are never changed afterwards;
+// they are copied first.
+type cache struct {
+	mu      sync.Mutex
+	regions map[regionKey]*list.Element
+	chunks  map[chunkKey]*list.Element
+	rlru    list.List // *worldRegion values; most recently used first.
+	clru    list.List // *worldChunk values; most recently used first.
+	size    int64     // Estimated memory use of all cached chunks and regions.
+}
+
+// init initializes an empty cache.
+func (c *cache) init() {
+	c.regions = make(map[regionKey]*list.Element)
+	c.chunks = make(map[chunkKey]*list.Element)
+	c.rlru.Init()
+	c.clru.Init()
+	c.size = 0
+}
+
+// Chunk returns the chunk at the given absolute chunk coordinates in the
+// specified dimension. Returns ErrChunkNotFound if the chunk does not
+// exist, or a *anvil.ChunkError if it can not be decoded.
+//
+// The chunk is decoded once and kept in the world's cache for subsequent
+// calls, until it is evicted. Changes made through SetBlock which have not
+// been flushed yet are included. The returned value is shared with the
+// cache and must not be modified; use SetBlock to change blocks.
+//
+// The returned chunk is a snapshot: later calls to SetBlock change a copy
+// of it, which is returned by subsequent calls to Chunk. Chunk may be
+// called from multiple goroutines.
+func (w *World) Chunk(dim string, x, z int) (*anvil.Chunk, error) {
+	c, err := w.chunk(dim, x, z)
+	if err != nil {
+		return nil, err
+	}
+
+	w.cache.mu.Lock()
+	defer w.cache.mu.Unlock()
+
+	c.shared = true
+	return c.chunk, nil
+}
+
+// RegionChunks returns the absolute chunk coordinates of all chunks in the
+// given region and dimension. The region is kept open in the world's
+// cache, so its chunks can be read with Chunk.
+func (w *World) RegionChunks(dim string, x, z int) ([][2]int, error) {
+	w.cache.mu.Lock()
+	r, err := w.region(dim, x*anvil.ChunksPerRegion, z*anvil.ChunksPerRegion)
+	w.cache.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	list := r.Chunks()
+	r.mu.Unlock()
+
+	for i := range list {
+		list[i][0] += x * anvil.ChunksPerRegion
+		list[i][1] += z * anvil.ChunksPerRegion
+	}
+
+	return list, nil
+}
+
+// Flush writes all chunks changed through SetBlock back to their regions
+// and saves those regions. Only regions with changed chunks are written
+// to disk. Each region is saved atomically, as with anvil.Region.Save.
+func (w *World) Flush() error {
+	w.cache.mu.Lock()
+	defer w.cache.mu.Unlock()
+
+	for e := w.cache.clru.Front(); e != nil; e = e.Next() {
+		err := w.writeChunk(e.Value.(*worldChunk))
+		if err != nil {
+			return err
+		}
+	}
+
+	for e := w.cache.rlru.Front(); e != nil; e = e.Next() {
+		err := w.saveRegion(e.Value.(*worldRegion))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes all regions opened by this world and clears its cache.
+// Changes which have not been flushed are lost.
+func (w *World) Close() error {
+	w.cache.mu.Lock()
+	defer w.cache.mu.Unlock()
+
+	var err error
+
+	for e := w.cache.rlru.Front(); e != nil; e = e.Next() {
+		if cerr := w.closeRegion(e.Value.(*worldRegion)); err == nil {
+			err = cerr
+		}
+	}
+
+	w.cache.init()
+	return err
+}
+
+// chunk returns the decoded chunk at the given absolute chunk
+// coordinates, loading it if necessary.
+func (w *World) chunk(dim string, x, z int) (*worldChunk, error) {
+	key := chunkKey{dim, x, z}
+
+	w.cache.mu.Lock()
+
+	if e, ok := w.cache.chunks[key]; ok {
+		w.cache.clru.MoveToFront(e)
+		w.cache.mu.Unlock()
+		return e.Value.(*worldChunk), nil
+	}
+
+	r, err := w.region(dim, x, z)
+	if err != nil {
+		w.cache.mu.Unlock()
+		return nil, err
+	}
+
+	r.users++
+	w.cache.mu.Unlock()
+
+	c := &worldChunk{key: key, region: r, chunk: new(anvil.Chunk)}
+
+	r.mu.Lock()
+	err = r.DecodeChunk(x, z, c.chunk)
+	size := r.LoadedSize()
+	r.mu.Unlock()
+
+	w.cache.mu.Lock()
+	defer w.cache.mu.Unlock()
+
+	r.users--
+
+	// The region may have been deleted in the meantime.
+	if e, ok := w.cache.regions[r.key]; !ok || e.Value != r {
+		return nil, ErrChunkNotFound
+	}
+
+	w.resizeRegion(r, size)
+
+	if errors.Is(err, anvil.ErrChunkNotFound) {
+		return nil, ErrChunkNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Another goroutine may have loaded the chunk in the meantime.
+	if e, ok := w.cache.chunks[key]; ok {
+		w.cache.clru.MoveToFront(e)
+		return e.Value.(*worldChunk), nil
+	}
+
+	c.size = chunkSize(c.chunk)
+	w.cache.size += c.size
+	w.cache.chunks[key] = w.cache.clru.PushFront(c)
+
+	err = w.trim(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// lockChunk returns the decoded chunk at the given absolute chunk
+// coordinates, like chunk. The cache is locked when it returns without
+// error, and the chunk is known to be cached.
+func (w *World) lockChunk(dim string, x, z int) (*worldChunk, error) {
+	for {
+		c, err := w.chunk(dim, x, z)
+		if err != nil {
+			return nil, err
+		}
+
+		w.cache.mu.Lock()
+
+		// The chunk may have been evicted in the meantime.
+		if e, ok := w.cache.chunks[c.key]; ok && e.Value == c {
+			return c, nil
+		}
+
+		w.cache.mu.Unlock()
+	}
+}
+
+// own makes sure the given chunk can be changed without affecting values
+// returned by Chunk. The cache must be locked.
+func (w *World) own(c *worldChunk) {
+	if c.shared {
+		c.chunk = c.chunk.Clone()
+		c.shared = false
+	}
+}
+
+// trim evicts the least recently used chunks, and then regions, until the
+// estimated memory use of the cache is within its limit. The given chunk
+// and its region are always kept, even if they exceed the limit by
+// themselves. The cache must be locked.
+func (w *World) trim(keep *worldChunk) error {
+	max := w.MaxMemory
+	if max <= 0 {
+		max = DefaultMaxMemory
+	}
+
+	for w.cache.size > max {
+		if e := w.cache.clru.Back(); e != nil && e.Value != keep {
+			err := w.evictChunk(e.Value.(*worldChunk))
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Only region data is left to release.
+		var idle *worldRegion
+		for e := w.cache.rlru.Back(); e != nil && idle == nil; e = e.Prev() {
+			if r := e.Value.(*worldRegion); r.users == 0 && r != keep.region {
+				idle = r
+			}
+		}
+
+		if idle == nil {
+			break
+		}
+
+		err := w.evictRegion(idle)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// region returns the open region holding the given absolute chunk
+// coordinates, opening it if necessary. The cache must be locked.
+func (w *World) region(dim string, x, z int) (*worldRegion, error) {
+	rx, rz := RegionCoords(x*anvil.BlocksPerChunk, z*anvil.BlocksPerChunk)
+	key := regionKey{dim, rx, rz}
+
+	if e, ok := w.cache.regions[key]; ok {
+		w.cache.rlru.MoveToFront(e)
+		return e.Value.(*worldRegion), nil
+	}
+
+	if !w.hasRegion(dim, rx, rz) {
+		return nil, ErrChunkNotFound
+	}
+
+	// Make room first, so evicting a region never drops chunks which
+	// are about to be loaded from the new one. Regions in use are kept,
+	// even if that exceeds the limit.
+	e := w.cache.rlru.Back()
+
+	for e != nil && w.cache.rlru.Len() >= limit(w.MaxRegions, DefaultMaxRegions) {
+		prev := e.Prev()
+
+		if r := e.Value.(*worldRegion); r.users == 0 {
+			err := w.evictRegion(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		e = prev
+	}
+
+	r, err := w.OpenRegion(dim, rx, rz)
+	if err != nil {
+		return nil, err
+	}
+
+	wr := &worldRegion{Region: r, key: key}
+	w.cache.regions[key] = w.cache.rlru.PushFront(wr)
+	return wr, nil
+}
+
+// evictChunk removes the given chunk from the cache, writing it back to
+// its region if it has been changed.
+func (w *World) evictChunk(c *worldChunk) error {
+	err := w.writeChunk(c)
+	if err != nil {
+		return err
+	}
+
+	w.cache.clru.Remove(w.cache.chunks[c.key])
+	delete(w.cache.chunks, c.key)
+	w.cache.size -= c.size
+	return nil
+}
+
+// evictRegion removes the given region and all its chunks from the
+// cache. Changes are saved before the region is closed.
+func (w *World) evictRegion(r *worldRegion) error {
+	var next *list.Element
+
+	for e := w.cache.clru.Front(); e != nil; e = next {
+		next = e.Next()
+
+		c := e.Value.(*worldChunk)
+		if c.region != r {
+			continue
+		}
+
+		err := w.evictChunk(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := w.saveRegion(r)
+	if err != nil {
+		return err
+	}
+
+	w.cache.rlru.Remove(w.cache.regions[r.key])
+	delete(w.cache.regions, r.key)
+	w.cache.size -= r.size
+	return w.closeRegion(r)
+}
+
+// dropRegion removes the given region and all its chunks from the cache,
+// discarding any changes.
+func (w *World) dropRegion(key regionKey) {
+	w.cache.mu.Lock()
+	defer w.cache.mu.Unlock()
+
+	e, ok := w.cache.regions[key]
+	if !ok {
+		return
+	}
+
+	r := e.Value.(*worldRegion)
+	var next *list.Element
+
+	for e := w.cache.clru.Front(); e != nil; e = next {
+		next = e.Next()
+
+		if c := e.Value.(*worldChunk); c.region == r {
+			w.cache.clru.Remove(e)
+			delete(w.cache.chunks, c.key)
+			w.cache.size -= c.size
+		}
+	}
+
+	w.cache.rlru.Remove(e)
+	delete(w.cache.regions, key)
+	w.cache.size -= r.size
+	w.closeRegion(r)
+}
+
+// writeChunk encodes the given chunk into its region, if it has been
+// changed. The region is not saved. The cache must be locked.
+func (w *World) writeChunk(c *worldChunk) error {
+	if !c.dirty {
+		return nil
+	}
+
+	// Encoding updates the chunk's height map.
+	w.own(c)
+
+	c.region.mu.Lock()
+	err := c.region.EncodeChunk(c.key.x, c.key.z, c.chunk)
+	size := c.region.LoadedSize()
+	c.region.mu.Unlock()
+
+	w.resizeRegion(c.region, size)
+
+	if err != nil {
+		return fmt.Errorf("mctools: %v", err)
+	}
+
+	c.region.changed = true
+	c.dirty = false
+	return nil
+}
+
+// saveRegion writes the given region to disk, if it holds changed chunks.
+func (w *World) saveRegion(r *worldRegion) error {
+	if !r.changed {
+		return nil
+	}
+
+	// Saving reads all chunk data still on disk into memory.
+	r.mu.Lock()
+	err := r.Save()
+	size := r.LoadedSize()
+	r.mu.Unlock()
+
+	w.resizeRegion(r, size)
+
+	if err != nil {
+		return fmt.Errorf("mctools: %v", err)
+	}
+
+	r.changed = false
+	return nil
+}
+
+// closeRegion closes the given region.
+func (w *World) closeRegion(r *worldRegion) error {
+	r.mu.Lock()
+	err := r.Close()
+	r.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("mctools: %v", err)
+	}
+
+	return nil
+}
+
+// resize updates the estimated memory use of the given chunk, after it
+// has been changed. The cache must be locked.
+func (w *World) resize(c *worldChunk) {
+	size := chunkSize(c.chunk)
+	w.cache.size += size - c.size
+	c.size = size
+}
+
+// resizeRegion records the amount of chunk data held by the given region.
+// The cache must be locked.
+func (w *World) resizeRegion(r *worldRegion, size int64) {
+	w.cache.size += size - r.size
+	r.size = size
+}
+
+// hasRegion returns true if the given region exists.
+func (w *World) hasRegion(dim string, x, z int) bool {
+	for _, xz := range w.regions[dim] {
+		if xz[0] == x && xz[1] == z {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chunkSize returns an estimate of the memory used by the given chunk,
+// in bytes.
+func chunkSize(c *anvil.Chunk) int64 {
+	n := int64(chunkOverhead + len(c.Biomes) + 4*len(c.HeightMap))
+	n += int64(entitySize * (len(c.Entities) + len(c.TileEntities) + len(c.TileTicks)))
+	n += valueSize(c.Unknown)
+
+	for i := range c.Sections {
+		s := &c.Sections[i]
+		n += int64(sectionOverhead + len(s.Blocks) + len(s.Add) + len(s.Data))
+		n += int64(len(s.BlockLight) + len(s.SkyLight) + 8*len(s.BlockStates))
+		n += int64(paletteSize * len(s.Palette))
+	}
+
+	return n
+}
+
+// valueSize returns an estimate of the memory used by the given NBT value,
+// in bytes.
+func valueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(16 + len(v))
+	case []byte:
+		return int64(24 + len(v))
+	case []int8:
+		return int64(24 + len(v))
+	case []int32:
+		return int64(24 + 4*len(v))
+	case []int64:
+		return int64(24 + 8*len(v))
+
+	case nbt.Compound:
+		n := int64(24)
+		for _, t := range v {
+			n += 16 + int64(len(t.Name)) + valueSize(t.Value)
+		}
+		return n
+
+	case nbt.List:
+		n := int64(32)
+		for _, e := range v.Values {
+			n += valueSize(e)
+		}
+		return n
+	}
+
+	return 16
+}
+
+// limit returns n if it is positive, or def otherwise.
+func limit(n, def int) int {
+	if n > 0 {
+		return n
+	}
+
+	return def
+}
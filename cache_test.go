@@ -0,0 +1,262 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mctools
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/kpfaulkner/mctools/anvil"
+	"github.com/kpfaulkner/mctools/anvil/item"
+)
+
+func TestWorldCache(t *testing.T) {
+	w := testWorld(t)
+	defer w.Close()
+
+	w.MaxMemory = 1
+	w.MaxRegions = 1
+
+	// Each block lives in a different chunk, and the last one in a
+	// different region, so every change is evicted by the next one.
+	blocks := []struct {
+		x, z int
+		id   item.Id
+	}{
+		{-1, -1, item.GoldOre},
+		{-17, -1, item.IronOre},
+		{1, 1, item.DiamondOre},
+	}
+
+	for _, tt := range blocks {
+		err := w.SetBlock(DimensionOverworld, tt.x, 10, tt.z, anvil.Block{Id: tt.id})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if w.cache.clru.Len() != 1 || w.cache.rlru.Len() != 1 {
+			t.Fatalf("cache size mismatch: have %d chunks, %d regions",
+				w.cache.clru.Len(), w.cache.rlru.Len())
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Close()
+
+	for _, tt := range blocks {
+		b, err := w.Block(DimensionOverworld, tt.x, 10, tt.z)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if b.Id != tt.id {
+			t.Fatalf("block (%d %d) mismatch: want %v; have %v", tt.x, tt.z, tt.id, b.Id)
+		}
+	}
+
+	c1, err := w.Chunk(DimensionOverworld, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2, err := w.Chunk(DimensionOverworld, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c1 != c2 {
+		t.Fatalf("cached chunk was decoded again")
+	}
+
+	// The region holding the chunk counts its compressed data.
+	r := w.cache.rlru.Front().Value.(*worldRegion)
+	if r.size <= 0 || r.size != r.LoadedSize() {
+		t.Fatalf("region size mismatch: have %d, want %d", r.size, r.LoadedSize())
+	}
+
+	if want := chunkSize(c1) + r.size; w.cache.size != want {
+		t.Fatalf("cache size mismatch: have %d, want %d", w.cache.size, want)
+	}
+}
+
+func TestWorldRegionChunks(t *testing.T) {
+	w := testWorld(t)
+	defer w.Close()
+
+	have, err := w.RegionChunks(DimensionOverworld, -1, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(have, func(i, j int) bool { return have[i][0] < have[j][0] })
+
+	if want := [][2]int{{-2, -1}, {-1, -1}}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("chunk list mismatch:\nHave: %v\nWant: %v", have, want)
+	}
+
+	if _, err = w.RegionChunks(DimensionOverworld, 5, 5); err != ErrChunkNotFound {
+		t.Fatalf("expected ErrChunkNotFound; have %v", err)
+	}
+}
+
+func TestWorldConcurrent(t *testing.T) {
+	w := testWorld(t)
+	defer w.Close()
+
+	// Every chunk load evicts the others, writing back any changes.
+	w.MaxMemory = 1
+
+	// A changed chunk is handed out before it is written back, which
+	// must leave the returned value alone.
+	err := w.SetBlock(DimensionOverworld, 1, 10, 1, anvil.Block{Id: item.GoldOre})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := w.Chunk(DimensionOverworld, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// scan reads every block of the given chunk up to its height map.
+	scan := func(c *anvil.Chunk) {
+		var b anvil.Block
+		for i, top := range c.HeightMap {
+			for y := int(top); y >= 0; y-- {
+				if s := c.Section(y, false); s != nil {
+					s.Read(i%anvil.BlocksPerChunk, y%anvil.BlocksPerSection, i/anvil.BlocksPerChunk, &b)
+				}
+			}
+		}
+	}
+
+	heights := append([]int32(nil), before.HeightMap...)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	flushed := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Keep reading the handed out chunk until it has been written back.
+			for done := false; !done; {
+				scan(before)
+
+				select {
+				case <-flushed:
+					done = true
+				default:
+				}
+			}
+
+			for n := 0; n < 20; n++ {
+				for _, rxz := range [][2]int{{-1, -1}, {0, 0}} {
+					list, err := w.RegionChunks(DimensionOverworld, rxz[0], rxz[1])
+					if err != nil {
+						errs <- err
+						return
+					}
+
+					for _, xz := range list {
+						c, err := w.Chunk(DimensionOverworld, xz[0], xz[1])
+						if err != nil {
+							errs <- err
+							return
+						}
+
+						scan(c)
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		err := w.Flush()
+		close(flushed)
+
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		for n := 0; n < 20; n++ {
+			for _, xz := range [][2]int{{-1, -1}, {-17, -1}, {1, 1}} {
+				err := w.SetBlock(DimensionOverworld, xz[0], 10, xz[1], anvil.Block{Id: item.IronOre})
+				if err == nil {
+					err = w.Flush()
+				}
+
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	var b anvil.Block
+	if s := before.Section(10, false); s == nil || !s.Read(1, 10, 1, &b) || b.Id != item.GoldOre {
+		t.Fatalf("returned chunk was changed: want %v; have %v", item.GoldOre, b.Id)
+	}
+
+	if !reflect.DeepEqual(before.HeightMap, heights) {
+		t.Fatalf("returned chunk's height map was changed")
+	}
+
+	if b, err = w.Block(DimensionOverworld, 1, 10, 1); err != nil || b.Id != item.IronOre {
+		t.Fatalf("block mismatch: want %v; have %v (%v)", item.IronOre, b.Id, err)
+	}
+}
+
+func TestWorldChunkError(t *testing.T) {
+	w := testWorld(t)
+	defer w.Close()
+
+	// Overwrite the compressed data of chunk 0,0, which follows the
+	// region header and the chunk's length and compression scheme.
+	f, err := os.OpenFile(filepath.Join(w.root, DimensionOverworld, "r.0.0.mca"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.WriteAt(bytes.Repeat([]byte{0xff}, 16), 2*4096+5)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = w.Chunk(DimensionOverworld, 0, 0)
+	if ce, ok := err.(*anvil.ChunkError); !ok || ce.X != 0 || ce.Z != 0 {
+		t.Fatalf("expected a chunk error; have %v", err)
+	}
+
+	if w.cache.clru.Len() != 0 {
+		t.Fatalf("undecodable chunk was cached")
+	}
+}
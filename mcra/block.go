@@ -7,46 +7,135 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/kpfaulkner/mctools"
 	"github.com/kpfaulkner/mctools/anvil"
 	"github.com/kpfaulkner/mctools/anvil/item"
 )
 
-// Location defines a specific block location in a world.
+// NetherScale is the number of overworld blocks covered by one block in
+// the Nether, along the X and Z axes.
+const NetherScale = 8
+
+// Location defines a specific block location in a world, in absolute
+// block coordinates.
 type Location struct {
-	RX int8  // Region X.
-	RZ int8  // Region Z.
-	CX int8  // Chunk X in region.
-	CZ int8  // Chunk Z in region.
-	BX uint8 // Block X in chunk.
-	BY uint8 // Block Y in chunk.
-	BZ uint8 // Block Z in chunk.
+	X int
+	Y int
+	Z int
+
+	// Dimension holds the dimension of the location, as one of the
+	// mctools.Dimension constants. It is empty if not known, which is
+	// the case for results of region and chunk searches.
+	Dimension string
 }
 
 func (l Location) String() string {
-	x := int(l.RX)*anvil.BlocksPerRegion + int(l.CX)*anvil.BlocksPerChunk + int(l.BX)
-	z := int(l.RZ)*anvil.BlocksPerRegion + int(l.CZ)*anvil.BlocksPerChunk + int(l.BZ)
-	y := int(l.BY)
-	return fmt.Sprintf("%d, %d, %d", x, y, z)
+	if len(l.Dimension) == 0 {
+		return fmt.Sprintf("%d, %d, %d", l.X, l.Y, l.Z)
+	}
+
+	return fmt.Sprintf("%d, %d, %d (%s)", l.X, l.Y, l.Z, dimensionName(l.Dimension))
 }
 
-// DistanceTo returns the distance, in blocks, between the two given locations.
-func (l Location) DistanceTo(b Location) uint {
-	ax := int(l.RX)*anvil.BlocksPerRegion + int(l.CX)*anvil.BlocksPerChunk + int(l.BX)
-	az := int(l.RZ)*anvil.BlocksPerRegion + int(l.CZ)*anvil.BlocksPerChunk + int(l.BZ)
-	ay := int(l.BY)
+// ToNether returns the Nether location matching this overworld location,
+// as used by portals. Locations without a dimension are treated as being
+// in the overworld. Returns false if the location is in the End.
+func (l Location) ToNether() (Location, bool) {
+	switch l.Dimension {
+	case mctools.DimensionNether:
+		return l, true
+	case "", mctools.DimensionOverworld:
+		l.X = floorDiv(l.X, NetherScale)
+		l.Z = floorDiv(l.Z, NetherScale)
+		l.Dimension = mctools.DimensionNether
+		return l, true
+	}
+
+	return l, false
+}
 
-	bx := int(b.RX)*anvil.BlocksPerRegion + int(b.CX)*anvil.BlocksPerChunk + int(b.BX)
-	bz := int(b.RZ)*anvil.BlocksPerRegion + int(b.CZ)*anvil.BlocksPerChunk + int(b.BZ)
-	by := int(b.BY)
+// ToOverworld returns the overworld location matching this Nether location,
+// as used by portals. Locations without a dimension are treated as being
+// in the overworld. Returns false if the location is in the End.
+func (l Location) ToOverworld() (Location, bool) {
+	switch l.Dimension {
+	case "", mctools.DimensionOverworld:
+		l.Dimension = mctools.DimensionOverworld
+		return l, true
+	case mctools.DimensionNether:
+		l.X *= NetherScale
+		l.Z *= NetherScale
+		l.Dimension = mctools.DimensionOverworld
+		return l, true
+	}
 
-	dx := float64(ax - bx)
-	dy := float64(ay - by)
-	dz := float64(az - bz)
+	return l, false
+}
+
+// SameDimension returns true if both locations are in the same dimension.
+// A location without a dimension is considered to match any dimension.
+func (l Location) SameDimension(b Location) bool {
+	return len(l.Dimension) == 0 || len(b.Dimension) == 0 || l.Dimension == b.Dimension
+}
+
+// Region returns the coordinates of the region holding this location.
+func (l Location) Region() (int, int) {
+	return mctools.RegionCoords(l.X, l.Z)
+}
+
+// Chunk returns the absolute coordinates of the chunk holding this location.
+func (l Location) Chunk() (int, int) {
+	return mctools.ChunkCoords(l.X, l.Z)
+}
+
+// ChunkInRegion returns the coordinates of the chunk holding this location,
+// relative to its region. They are in the range 0-31.
+func (l Location) ChunkInRegion() (int, int) {
+	cx, cz := l.Chunk()
+	rx, rz := l.Region()
+	return cx - rx*anvil.ChunksPerRegion, cz - rz*anvil.ChunksPerRegion
+}
+
+// BlockInChunk returns the coordinates of this location, relative to the
+// chunk holding it. X and Z are in the range 0-15.
+func (l Location) BlockInChunk() (int, int, int) {
+	return mctools.BlockCoords(l.X, l.Y, l.Z)
+}
+
+// DistanceTo returns the distance, in blocks, between the two given locations.
+// Their dimensions are not taken into account; see SameDimension.
+func (l Location) DistanceTo(b Location) uint {
+	dx := float64(l.X - b.X)
+	dy := float64(l.Y - b.Y)
+	dz := float64(l.Z - b.Z)
 	dist := math.Abs(math.Sqrt(dx*dx + dy*dy + dz*dz))
 	return uint(dist)
 }
 
-// Block defines a block location in region, chunk and block coordinates.
+// floorDiv divides a by b, rounding towards negative infinity.
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return (a - b + 1) / b
+	}
+
+	return a / b
+}
+
+// dimensionName returns a readable name for the given dimension.
+func dimensionName(dim string) string {
+	switch dim {
+	case mctools.DimensionOverworld:
+		return "overworld"
+	case mctools.DimensionNether:
+		return "nether"
+	case mctools.DimensionEnd:
+		return "end"
+	}
+
+	return dim
+}
+
+// Block defines a block type at a specific location.
 type Block struct {
 	Id item.Id // Type of block at this location.
 	Location
@@ -0,0 +1,196 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mcra
+
+import (
+	"github.com/kpfaulkner/mctools/anvil"
+	"github.com/kpfaulkner/mctools/anvil/biome"
+	"github.com/kpfaulkner/mctools/anvil/item"
+)
+
+// The queries in this file look at the chunk holding a block. They
+// implement ChunkQuery, and their IsTarget method always returns false
+// as it has no chunk to look at.
+
+// ChunkView gives a ChunkQuery access to the chunk holding a block, along
+// with the chunks around it.
+type ChunkView struct {
+	Chunk *anvil.Chunk // Chunk holding the block.
+	X, Z  int          // Absolute chunk coordinates of Chunk.
+
+	lookup func(cx, cz int) *anvil.Chunk // Yields neighbouring chunks; may be nil.
+}
+
+// Neighbour returns the chunk at the given absolute chunk coordinates.
+//
+// Returns nil if the chunk does not exist, or is not available to the
+// current search. Region searches only have access to the chunks in the
+// same region; VisitChunk and FindInChunk have no access to neighbours.
+func (v *ChunkView) Neighbour(cx, cz int) *anvil.Chunk {
+	if cx == v.X && cz == v.Z {
+		return v.Chunk
+	}
+
+	if v.lookup == nil {
+		return nil
+	}
+
+	return v.lookup(cx, cz)
+}
+
+// Block returns the block at the given absolute coordinates, which may
+// lie in a neighbouring chunk. Blocks above the world's height limit and
+// in sections which have not been generated are air.
+//
+// Returns false if y is negative, or the chunk holding the block is not
+// available; see Neighbour.
+func (v *ChunkView) Block(x, y, z int) (anvil.Block, bool) {
+	if y < 0 {
+		return anvil.Block{}, false
+	}
+
+	if y >= anvil.MaxChunkHeight {
+		return anvil.Block{State: anvil.AirState, SkyLight: anvil.MaxLight}, true
+	}
+
+	cx := floorDiv(x, anvil.BlocksPerChunk)
+	cz := floorDiv(z, anvil.BlocksPerChunk)
+
+	c := v.Neighbour(cx, cz)
+	if c == nil {
+		return anvil.Block{}, false
+	}
+
+	return readBlock(c, x-cx*anvil.BlocksPerChunk, y, z-cz*anvil.BlocksPerChunk)
+}
+
+// BiomeQuery finds all blocks in any of a set of biomes.
+type BiomeQuery []biome.Id
+
+// NewBiomeQuery creates a new query for blocks in any of the given biomes.
+func NewBiomeQuery(biomes ...biome.Id) Query {
+	return BiomeQuery(biomes)
+}
+
+// IsTarget always returns false. See IsTargetInChunk.
+func (q BiomeQuery) IsTarget(b Block) bool { return false }
+
+// IsTargetInChunk returns true if the given block, taken from
+// the chunk in v, should be included in the result set.
+func (q BiomeQuery) IsTargetInChunk(v *ChunkView, b Block) bool {
+	id, ok := v.Chunk.Biome(b.BlockInChunk())
+	if !ok {
+		return false
+	}
+
+	for _, v := range q {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LightQuery finds all blocks with a light level in a given range.
+type LightQuery struct {
+	min, max uint8
+	sky      bool
+}
+
+// NewBlockLightQuery creates a new query for blocks which receive an amount
+// of light from light-emitting blocks in the range min-max, inclusive.
+func NewBlockLightQuery(min, max uint8) Query {
+	return &LightQuery{min: min, max: max}
+}
+
+// NewSkyLightQuery creates a new query for blocks which receive an amount
+// of light from the sky in the range min-max, inclusive.
+func NewSkyLightQuery(min, max uint8) Query {
+	return &LightQuery{min: min, max: max, sky: true}
+}
+
+// IsTarget always returns false. See IsTargetInChunk.
+func (q *LightQuery) IsTarget(b Block) bool { return false }
+
+// IsTargetInChunk returns true if the given block, taken from
+// the chunk in v, should be included in the result set.
+func (q *LightQuery) IsTargetInChunk(v *ChunkView, b Block) bool {
+	x, y, z := b.BlockInChunk()
+
+	block, ok := readBlock(v.Chunk, x, y, z)
+	if !ok {
+		return false
+	}
+
+	light := block.BlockLight
+	if q.sky {
+		light = block.SkyLight
+	}
+
+	return light >= q.min && light <= q.max
+}
+
+// ExposedQuery finds all blocks which have air on at least one side.
+//
+// Neighbours in adjacent chunks are looked up as needed. Neighbours in
+// chunks which are not available to the search are not air; see
+// ChunkView.Neighbour. Blocks above the world's height limit and in
+// sections which have not been generated are air.
+type ExposedQuery struct{}
+
+// NewExposedQuery creates a new query for blocks exposed to air.
+func NewExposedQuery() Query {
+	return ExposedQuery{}
+}
+
+// IsTarget always returns false. See IsTargetInChunk.
+func (q ExposedQuery) IsTarget(b Block) bool { return false }
+
+// IsTargetInChunk returns true if the given block, taken from
+// the chunk in v, should be included in the result set.
+func (q ExposedQuery) IsTargetInChunk(v *ChunkView, b Block) bool {
+	sides := [...][3]int{
+		{b.X - 1, b.Y, b.Z}, {b.X + 1, b.Y, b.Z},
+		{b.X, b.Y - 1, b.Z}, {b.X, b.Y + 1, b.Z},
+		{b.X, b.Y, b.Z - 1}, {b.X, b.Y, b.Z + 1},
+	}
+
+	for _, p := range sides {
+		block, ok := v.Block(p[0], p[1], p[2])
+		if ok && isAir(&block) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readBlock reads the block at the given chunk coordinates.
+// Blocks in sections which have not been generated are air.
+func readBlock(c *anvil.Chunk, x, y, z int) (anvil.Block, bool) {
+	var b anvil.Block
+
+	s := c.Section(y, false)
+	if s == nil {
+		b.State = anvil.AirState
+		b.SkyLight = anvil.MaxLight
+		return b, true
+	}
+
+	ok := s.Read(x, y%anvil.BlocksPerSection, z, &b)
+	return b, ok
+}
+
+// isAir returns true if b is any kind of air.
+func isAir(b *anvil.Block) bool {
+	switch b.State {
+	case anvil.AirState, "minecraft:cave_air", "minecraft:void_air":
+		return true
+	case "":
+		return b.Id == item.Air
+	}
+
+	return false
+}
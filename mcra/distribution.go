@@ -0,0 +1,328 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mcra
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/kpfaulkner/mctools"
+	"github.com/kpfaulkner/mctools/anvil"
+	"github.com/kpfaulkner/mctools/anvil/biome"
+	"github.com/kpfaulkner/mctools/anvil/item"
+)
+
+// TallyMode defines how a Distribution breaks down its counts.
+type TallyMode int
+
+// Known tally modes.
+const (
+	ByY       TallyMode = iota // Counts per Y level.
+	BySection                  // Counts per section index; 16 Y levels each.
+	ByBiome                    // Counts per biome.
+	ByChunk                    // Counts per chunk.
+)
+
+func (m TallyMode) String() string {
+	switch m {
+	case ByY:
+		return "y"
+	case BySection:
+		return "section"
+	case ByBiome:
+		return "biome"
+	case ByChunk:
+		return "chunk"
+	}
+
+	return "TallyMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// Bucket identifies a group of blocks in a Distribution. Only the fields
+// used by the distribution's mode are set.
+type Bucket struct {
+	Y       int      // Y level, for ByY.
+	Section int      // Section index, for BySection.
+	Biome   biome.Id // Biome, for ByBiome.
+	ChunkX  int      // Absolute chunk X coordinate, for ByChunk.
+	ChunkZ  int      // Absolute chunk Z coordinate, for ByChunk.
+}
+
+// less returns true if b sorts before v.
+func (b Bucket) less(v Bucket) bool {
+	switch {
+	case b.Y != v.Y:
+		return b.Y < v.Y
+	case b.Section != v.Section:
+		return b.Section < v.Section
+	case b.Biome != v.Biome:
+		return b.Biome < v.Biome
+	case b.ChunkX != v.ChunkX:
+		return b.ChunkX < v.ChunkX
+	}
+
+	return b.ChunkZ < v.ChunkZ
+}
+
+// Distribution defines item counts, broken down into buckets according to
+// its mode.
+type Distribution struct {
+	Mode   TallyMode
+	Counts map[Bucket]TallyResult
+}
+
+// NewDistribution creates a new, empty distribution with the given mode.
+func NewDistribution(mode TallyMode) *Distribution {
+	return &Distribution{
+		Mode:   mode,
+		Counts: make(map[Bucket]TallyResult),
+	}
+}
+
+// Buckets returns all buckets in the distribution, in ascending order.
+func (d *Distribution) Buckets() []Bucket {
+	out := make([]Bucket, 0, len(d.Counts))
+	for b := range d.Counts {
+		out = append(out, b)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].less(out[j]) })
+	return out
+}
+
+// Total returns the counts for all buckets combined.
+func (d *Distribution) Total() TallyResult {
+	out := make(TallyResult)
+
+	for _, set := range d.Counts {
+		for id, n := range set {
+			out[id] += n
+		}
+	}
+
+	return out
+}
+
+// Merge adds the counts from v to the distribution. Both must have the
+// same mode.
+func (d *Distribution) Merge(v *Distribution) {
+	for b, set := range v.Counts {
+		for id, n := range set {
+			d.add(b, id, n)
+		}
+	}
+}
+
+// add adds n to the count for the given bucket and item.
+func (d *Distribution) add(b Bucket, id item.Id, n uint64) {
+	set, ok := d.Counts[b]
+	if !ok {
+		set = make(TallyResult)
+		d.Counts[b] = set
+	}
+
+	set[id] += n
+}
+
+// columns returns the names of the bucket columns for the distribution's
+// mode, along with their values for bucket b.
+func (d *Distribution) columns(b Bucket) ([]string, []interface{}) {
+	switch d.Mode {
+	case ByY:
+		return []string{"y"}, []interface{}{b.Y}
+	case BySection:
+		return []string{"section"}, []interface{}{b.Section}
+	case ByBiome:
+		return []string{"biome"}, []interface{}{b.Biome.String()}
+	case ByChunk:
+		return []string{"chunk_x", "chunk_z"}, []interface{}{b.ChunkX, b.ChunkZ}
+	}
+
+	return nil, nil
+}
+
+// WriteCSV writes the distribution to w in CSV format. It holds one row
+// for each bucket and item, sorted by bucket and item id. The first row
+// names the columns: the bucket columns for the distribution's mode,
+// followed by "item" and "count".
+func (d *Distribution) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	names, _ := d.columns(Bucket{})
+	cw.Write(append(names, "item", "count"))
+
+	for _, b := range d.Buckets() {
+		_, values := d.columns(b)
+		set := d.Counts[b]
+
+		ids := make([]item.Id, 0, len(set))
+		for id := range set {
+			ids = append(ids, id)
+		}
+
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		for _, id := range ids {
+			row := make([]string, 0, len(values)+2)
+			for _, v := range values {
+				switch v := v.(type) {
+				case int:
+					row = append(row, strconv.Itoa(v))
+				case string:
+					row = append(row, v)
+				}
+			}
+
+			row = append(row, id.String(), strconv.FormatUint(set[id], 10))
+			cw.Write(row)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// MarshalJSON encodes the distribution as a JSON object with the mode and
+// a list of buckets, in ascending order. Each bucket holds the columns for
+// the distribution's mode, as used by WriteCSV, and the item counts keyed
+// by item name.
+func (d *Distribution) MarshalJSON() ([]byte, error) {
+	type jsonDistribution struct {
+		Mode    string                   `json:"mode"`
+		Buckets []map[string]interface{} `json:"buckets"`
+	}
+
+	v := jsonDistribution{
+		Mode:    d.Mode.String(),
+		Buckets: make([]map[string]interface{}, 0, len(d.Counts)),
+	}
+
+	for _, b := range d.Buckets() {
+		names, values := d.columns(b)
+		m := make(map[string]interface{}, len(names)+1)
+
+		for i := range names {
+			m[names[i]] = values[i]
+		}
+
+		counts := make(map[string]uint64, len(d.Counts[b]))
+		for id, n := range d.Counts[b] {
+			counts[id.String()] += n
+		}
+
+		m["counts"] = counts
+		v.Buckets = append(v.Buckets, m)
+	}
+
+	return json.Marshal(v)
+}
+
+// DistributeInChunk counts the number of times each of the given items
+// occurs in the specified chunk, broken down according to mode.
+//
+// If the given item set is empty, all blocks will be counted. For ByBiome,
+// blocks in chunks without biome data are not counted.
+func DistributeInChunk(c *anvil.Chunk, mode TallyMode, items ...item.Id) *Distribution {
+	out := NewDistribution(mode)
+	distributeInChunk(c, int(c.X), int(c.Z), items, out)
+	return out
+}
+
+// DistributeInRegion counts the number of times each of the given items
+// occurs in the specified region, broken down according to mode.
+//
+// If the given item set is empty, all blocks will be counted. For ByBiome,
+// blocks in chunks without biome data are not counted.
+func DistributeInRegion(r *anvil.Region, mode TallyMode, items ...item.Id) *Distribution {
+	out := NewDistribution(mode)
+	distributeChunks(context.Background(), regionChunks(r), items, out)
+	return out
+}
+
+// DistributeInWorld counts the number of times each of the given items
+// occurs in the given dimension of a world, broken down according to
+// mode. Regions are scanned concurrently, as with TallyInWorld.
+//
+// If the given item set is empty, all blocks will be counted. For ByBiome,
+// blocks in chunks without biome data are not counted.
+func DistributeInWorld(ctx context.Context, w *mctools.World, dim string, mode TallyMode, opt *ScanOptions, items ...item.Id) (*Distribution, error) {
+	regions := worldRegions(w, dim)
+	results := make([]*Distribution, len(regions))
+
+	err := scanWorld(ctx, w, dim, regions, opt, func(ctx context.Context, i int, src chunkSource) error {
+		results[i] = NewDistribution(mode)
+		return distributeChunks(ctx, src, items, results[i])
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := NewDistribution(mode)
+	for _, d := range results {
+		out.Merge(d)
+	}
+
+	return out, nil
+}
+
+// distributeChunks counts the given items in the chunks from src. It
+// stops early if ctx is cancelled and returns its error.
+func distributeChunks(ctx context.Context, src chunkSource, items []item.Id, out *Distribution) error {
+	return src(ctx, func(v *ChunkView) bool {
+		distributeInChunk(v.Chunk, v.X, v.Z, items, out)
+		return true
+	})
+}
+
+// distributeInChunk counts the given items in the specified chunk, which
+// is at the given absolute chunk coordinates.
+func distributeInChunk(c *anvil.Chunk, cx, cz int, items []item.Id, out *Distribution) {
+	var x, y, z int
+	var block anvil.Block
+
+	for i := range c.Sections {
+		s := &c.Sections[i]
+
+		if len(items) > 0 && !s.ContainsAny(items...) {
+			continue
+		}
+
+		sy := int(s.Y) * anvil.BlocksPerSection
+
+		for y = 0; y < anvil.BlocksPerSection; y++ {
+			for x = 0; x < anvil.BlocksPerChunk; x++ {
+				for z = 0; z < anvil.BlocksPerChunk; z++ {
+					if !s.Read(x, y, z, &block) || !hasItem(items, block.Id) {
+						continue
+					}
+
+					var b Bucket
+
+					switch out.Mode {
+					case ByY:
+						b.Y = sy + y
+					case BySection:
+						b.Section = int(s.Y)
+					case ByBiome:
+						id, ok := c.Biome(x, sy+y, z)
+						if !ok {
+							continue
+						}
+
+						b.Biome = id
+					case ByChunk:
+						b.ChunkX, b.ChunkZ = cx, cz
+					}
+
+					out.add(b, block.Id, 1)
+				}
+			}
+		}
+	}
+}
@@ -8,12 +8,13 @@ Specifically intended to tally and locate sets of specific resources.
 This code has been run on a few really old worlds, as well as a brand
 new one generated in 1.8.3 and found to be working in all of them.
 
-It should be noted that no attempts have been made at speed optimization'
-as far as block search performance goes. Specifically when searching all
-regions in a world, things can get rather slow.
+Searching all regions in a world can get rather slow. FindInWorld and
+TallyInWorld spread the work over a pool of workers, one region at a time,
+and can be cancelled through a context.
 
-The library operates directly on the world's region data. Nothing is
-cached or indexed in any way.
+Region searches operate directly on the region data. World searches read
+chunks through the world's cache, so repeated searches do not decode the
+same chunks again. Nothing is indexed in any way.
 
 
 Usage example
@@ -74,6 +75,74 @@ Tallying redstone and diamond ores in a region:
 	//     DiamondOre 25
 
 
+Combining queries, to find diamond ore below y=16 in a jungle, which is
+not exposed to air:
+
+	result := FindInRegion(region, And(
+		NewInclusionQuery(item.DiamondOre),
+		NewYRangeQuery(0, 15),
+		NewBiomeQuery(biome.Jungle, biome.JungleHills),
+		Not(NewExposedQuery()),
+	))
+
+Region scans only see the chunks of their own region, so blocks on a
+region's edge are never exposed to the next region. FindInWorld checks
+neighbouring regions as well.
+
+
+The same query can be written as text and compiled with ParseQuery.
+Refer to its documentation for the full syntax:
+
+	q, err := ParseQuery("id = DiamondOre and y < 16 and " +
+		"biome in (Jungle, JungleHills) and not exposed")
+
+
+Visiting matches as they are found, without keeping them in memory:
+
+	VisitRegion(region, NewExclusionQuery(item.Air), func(b Block) bool {
+		fmt.Println(b)
+		return true // Return false to stop the search.
+	})
+
+
+Scanning all regions in the overworld, with progress reports:
+
+	opt := &ScanOptions{
+		Progress: func(done, total int) {
+			fmt.Printf("%d/%d regions\n", done, total)
+		},
+	}
+
+	result, err := FindInWorld(ctx, world, mctools.DimensionOverworld,
+		NewInclusionQuery(item.DiamondOre), opt)
+
+	tally, err := TallyInWorld(ctx, world, mctools.DimensionOverworld, opt,
+		item.DiamondOre)
+
+
+Grouping diamond ore into veins, nearest to the world spawn first:
+
+	veins := FindVeins(result, FaceAdjacent)
+	SortVeinsByDistance(veins, Location{X: spawnX, Y: spawnY, Z: spawnZ})
+
+	for _, v := range veins {
+		fmt.Println(v.Size(), v.Centroid)
+	}
+
+
+Charting the distribution of diamond ore by Y level:
+
+	d := DistributeInRegion(region, ByY, item.DiamondOre)
+	err := d.WriteCSV(os.Stdout)
+
+	// yields:
+	//
+	//     y,item,count
+	//     5,DiamondOre,4
+	//     6,DiamondOre,3
+	//     ...
+
+
 Tally all resources in a region:
 
 	tally := TallyInRegion(region)
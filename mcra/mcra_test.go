@@ -4,12 +4,19 @@
 package mcra
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/kpfaulkner/mctools"
 	"github.com/kpfaulkner/mctools/anvil"
+	"github.com/kpfaulkner/mctools/anvil/biome"
 	"github.com/kpfaulkner/mctools/anvil/item"
 )
 
@@ -81,8 +88,8 @@ func TestExclusionQuery(t *testing.T) {
 func TestRadiusQuery(t *testing.T) {
 	result := FindInRegion(region, NewRadiusQuery(
 		Location{
-			RX: int8(region.X),
-			RZ: int8(region.Z),
+			X: region.X * anvil.BlocksPerRegion,
+			Z: region.Z * anvil.BlocksPerRegion,
 		},
 		100, // radius
 		item.Bedrock,
@@ -122,3 +129,484 @@ loopy:
 		t.Fatalf("%s: expected %d results; have %d", k, want, v)
 	}
 }
+
+func TestFindInWorld(t *testing.T) {
+	var calls int
+	opt := &ScanOptions{
+		Workers:  4,
+		Progress: func(done, total int) { calls++ },
+	}
+
+	q := NewInclusionQuery(item.DiamondOre)
+
+	result, err := FindInWorld(context.Background(), world, mctools.DimensionOverworld, q, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regions := worldRegions(world, mctools.DimensionOverworld)
+	if calls != len(regions) {
+		t.Fatalf("expected %d progress calls; have %d", len(regions), calls)
+	}
+
+	// Results must match a sequential scan, in the same order.
+	var want BlockList
+	for _, xz := range regions {
+		r, err := world.OpenRegion(mctools.DimensionOverworld, xz[0], xz[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want = append(want, FindInRegion(r, q)...)
+		r.Close()
+	}
+
+	for i := range want {
+		want[i].Dimension = mctools.DimensionOverworld
+	}
+
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("result mismatch: want %d blocks; have %d", want.Len(), result.Len())
+	}
+}
+
+func TestFindInWorldUnflushed(t *testing.T) {
+	w := createWorld(t, [2]int{0, 0})
+	defer w.Close()
+
+	// Changes which have not been flushed must be found.
+	err := w.SetBlock(mctools.DimensionOverworld, 1, 10, 2, anvil.Block{Id: item.GoldOre})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewInclusionQuery(item.GoldOre)
+
+	result, err := FindInWorld(context.Background(), w, mctools.DimensionOverworld, q, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := BlockList{{Id: item.GoldOre, Location: Location{X: 1, Y: 10, Z: 2, Dimension: mctools.DimensionOverworld}}}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("result mismatch:\nHave: %v\nWant: %v", result, want)
+	}
+}
+
+func TestExposedQueryNeighbours(t *testing.T) {
+	const dim = mctools.DimensionOverworld
+
+	w := createWorld(t, [2]int{0, 0}, [2]int{1, 0})
+	defer w.Close()
+
+	// A gold ore at the eastern edge of chunk 0,0, enclosed in stone on
+	// all sides except the one facing chunk 1,0.
+	blocks := map[[3]int]item.Id{
+		{15, 10, 1}: item.GoldOre,
+		{14, 10, 1}: item.Stone,
+		{15, 9, 1}:  item.Stone,
+		{15, 11, 1}: item.Stone,
+		{15, 10, 0}: item.Stone,
+		{15, 10, 2}: item.Stone,
+	}
+
+	for p, id := range blocks {
+		err := w.SetBlock(dim, p[0], p[1], p[2], anvil.Block{Id: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := And(NewInclusionQuery(item.GoldOre), NewExposedQuery())
+
+	find := func() BlockList {
+		result, err := FindInWorld(context.Background(), w, dim, q, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return result
+	}
+
+	if result := find(); result.Len() != 1 {
+		t.Fatalf("expected the ore to be exposed to chunk 1,0; have %v", result)
+	}
+
+	// Region scans see the neighbouring chunks in the same region.
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := w.LoadRegion(dim, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := FindInRegion(r, q); result.Len() != 1 {
+		t.Fatalf("expected the ore to be exposed in a region scan; have %v", result)
+	}
+
+	err = w.SetBlock(dim, 16, 10, 1, anvil.Block{Id: item.Stone})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := find(); result.Len() != 0 {
+		t.Fatalf("expected the ore to be enclosed; have %v", result)
+	}
+}
+
+func TestNotChunkQuery(t *testing.T) {
+	b := Block{Id: item.Stone}
+
+	for _, q := range []Query{
+		Not(NewExposedQuery()),
+		Not(Not(NewExposedQuery())),
+		Not(And(NewInclusionQuery(item.Stone), NewSkyLightQuery(0, 15))),
+	} {
+		if q.IsTarget(b) {
+			t.Fatalf("%#v: expected no match without a chunk", q)
+		}
+	}
+
+	if !Not(NewInclusionQuery(item.Dirt)).IsTarget(b) {
+		t.Fatalf("expected a match for a query without chunk data")
+	}
+}
+
+// createWorld creates an empty world in a temporary directory, holding
+// empty chunks at the given chunk coordinates of region 0,0 in the
+// overworld.
+func createWorld(t *testing.T, chunks ...[2]int) *mctools.World {
+	t.Helper()
+
+	root := t.TempDir()
+
+	data, err := ioutil.ReadFile(worldPath + "level.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(root, "level.dat"), data, 0644)
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(root, mctools.DimensionOverworld), 0755)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := mctools.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := w.CreateRegion(mctools.DimensionOverworld, 0, 0)
+	if err != nil {
+		w.Close()
+		t.Fatal(err)
+	}
+
+	for _, xz := range chunks {
+		var c anvil.Chunk
+		c.Init(xz[0], xz[1])
+
+		if err = r.EncodeChunk(xz[0], xz[1], &c); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = r.Save()
+	}
+
+	if err != nil {
+		w.Close()
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+func TestTallyInWorldCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := TallyInWorld(ctx, world, mctools.DimensionOverworld, nil)
+	if err != context.Canceled {
+		t.Fatalf("error mismatch: want %v; have %v", context.Canceled, err)
+	}
+}
+
+func TestVisitWorldStop(t *testing.T) {
+	var n int
+
+	err := VisitWorld(context.Background(), world, mctools.DimensionOverworld,
+		NewExclusionQuery(), nil, func(b Block) bool {
+			n++
+			return n < 100
+		})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 100 {
+		t.Fatalf("expected 100 visited blocks; have %d", n)
+	}
+}
+
+// plainQuery hides the CandidateQuery implementation of a query.
+type plainQuery struct{ Query }
+
+func TestCandidateQuery(t *testing.T) {
+	q := NewInclusionQuery(item.DiamondOre, item.GoldOre)
+
+	have := FindInRegion(region, q)
+	want := FindInRegion(region, plainQuery{q})
+
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("result mismatch: want %d blocks; have %d", want.Len(), have.Len())
+	}
+}
+
+func TestCombinedQuery(t *testing.T) {
+	var c anvil.Chunk
+	c.Init(0, 0)
+	c.Biomes[0] = int8(biome.Jungle)
+
+	// Two diamond ores in a jungle column, one of them next to a cave.
+	// A third one sits too high, in a plains column.
+	c.Section(0, true).Write(0, 10, 0, &anvil.Block{Id: item.DiamondOre})
+	c.Section(0, true).Write(0, 12, 0, &anvil.Block{Id: item.DiamondOre})
+	c.Section(32, true).Write(5, 0, 5, &anvil.Block{Id: item.DiamondOre})
+
+	for y := 0; y < 48; y++ {
+		s := c.Section(y, true)
+		for i := 0; i < 256; i++ {
+			var b anvil.Block
+			s.Read(i%16, y%16, i/16, &b)
+
+			if b.Id == item.Air {
+				s.Write(i%16, y%16, i/16, &anvil.Block{Id: item.Stone})
+			}
+		}
+	}
+
+	c.Section(0, false).Write(1, 12, 0, &anvil.Block{Id: item.Air})
+
+	result := FindInChunk(&c, And(
+		NewInclusionQuery(item.DiamondOre),
+		NewYRangeQuery(0, 15),
+		NewBiomeQuery(biome.Jungle),
+		Not(NewExposedQuery()),
+	))
+
+	if result.Len() != 1 || result[0].Y != 10 {
+		t.Fatalf("expected 1 block at y=10; have %v", result)
+	}
+
+	result = FindInChunk(&c, Or(
+		NewBoxQuery(5, 32, 5, 5, 32, 5),
+		NewInclusionQuery(item.Air),
+	))
+
+	if result.Len() != 2 {
+		t.Fatalf("expected 2 results; have %d", result.Len())
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	var c anvil.Chunk
+	c.Init(0, 0)
+	c.Biomes[0] = int8(biome.Jungle)
+
+	c.Section(0, true).Write(0, 10, 0, &anvil.Block{Id: item.DiamondOre})
+	c.Section(0, true).Write(1, 10, 0, &anvil.Block{Id: item.RedstoneOre})
+	c.Section(20, true).Write(0, 4, 0, &anvil.Block{Id: item.DiamondOre})
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"id = DiamondOre", 2},
+		{"id = 56:0", 2},
+		{"id in (diamondore, RedstoneOre) and y < 16", 2},
+		{"id in (DiamondOre, RedstoneOre) and y < 16 and biome = Jungle", 1},
+		{"id = DiamondOre and not (y >= 16 or x != 0)", 1},
+		{"id = RedstoneOre within 1 of 0,10,0", 1},
+		{"id = RedstoneOre within 1 of 0,12,0", 0},
+		{"id = DiamondOre and exposed", 2},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+
+		if have := FindInChunk(&c, q).Len(); have != tt.want {
+			t.Fatalf("%s: expected %d results; have %d", tt.query, tt.want, have)
+		}
+	}
+
+	for _, v := range []string{
+		"",
+		"id",
+		"id = NoSuchBlock",
+		"id in (DiamondOre",
+		"y << 3",
+		"y < 3 and",
+		"colour = red",
+		"exposed within 10 of 1,2",
+	} {
+		if _, err := ParseQuery(v); err == nil {
+			t.Fatalf("%q: expected error", v)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	// Far beyond the range of the old 8-bit region coordinates.
+	l := Location{X: -100000, Y: 70, Z: 3000001}
+
+	if x, z := l.Region(); x != -196 || z != 5859 {
+		t.Fatalf("region mismatch: have %d, %d", x, z)
+	}
+
+	if x, z := l.Chunk(); x != -6250 || z != 187500 {
+		t.Fatalf("chunk mismatch: have %d, %d", x, z)
+	}
+
+	if x, z := l.ChunkInRegion(); x != 22 || z != 12 {
+		t.Fatalf("chunk in region mismatch: have %d, %d", x, z)
+	}
+
+	if x, y, z := l.BlockInChunk(); x != 0 || y != 70 || z != 1 {
+		t.Fatalf("block in chunk mismatch: have %d, %d, %d", x, y, z)
+	}
+
+	if d := l.DistanceTo(Location{X: -100000, Y: 70, Z: 3000011}); d != 10 {
+		t.Fatalf("distance mismatch: want 10; have %d", d)
+	}
+}
+
+func TestLocationDimension(t *testing.T) {
+	l := Location{X: -17, Y: 64, Z: 100}
+
+	nether, ok := l.ToNether()
+	if !ok || nether != (Location{X: -3, Y: 64, Z: 12, Dimension: mctools.DimensionNether}) {
+		t.Fatalf("nether location mismatch: have %v", nether)
+	}
+
+	over, ok := nether.ToOverworld()
+	if !ok || over != (Location{X: -24, Y: 64, Z: 96, Dimension: mctools.DimensionOverworld}) {
+		t.Fatalf("overworld location mismatch: have %v", over)
+	}
+
+	if over.SameDimension(nether) || !over.SameDimension(l) {
+		t.Fatalf("dimension comparison mismatch")
+	}
+
+	if _, ok := (Location{Dimension: mctools.DimensionEnd}).ToNether(); ok {
+		t.Fatalf("expected failure for the End")
+	}
+}
+
+func TestFindVeins(t *testing.T) {
+	at := func(id item.Id, x, y, z int) Block {
+		return Block{Id: id, Location: Location{X: x, Y: y, Z: z}}
+	}
+
+	blocks := BlockList{
+		at(item.DiamondOre, 100, 10, 100),
+		at(item.DiamondOre, 101, 10, 100),
+		at(item.DiamondOre, 102, 11, 100), // Edge-adjacent only.
+		at(item.GoldOre, 100, 11, 100),    // Different id.
+		at(item.DiamondOre, 0, 5, 0),
+		at(item.DiamondOre, 0, 5, 0), // Duplicate.
+	}
+
+	tests := []struct {
+		adj   Adjacency
+		sizes []int
+	}{
+		{FaceAdjacent, []int{2, 1, 1, 1}},
+		{EdgeAdjacent, []int{3, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		veins := FindVeins(blocks, tt.adj)
+
+		if len(veins) != len(tt.sizes) {
+			t.Fatalf("adjacency %d: expected %d veins; have %d", tt.adj, len(tt.sizes), len(veins))
+		}
+
+		for i, v := range veins {
+			if v.Size() != tt.sizes[i] {
+				t.Fatalf("adjacency %d: vein %d: expected size %d; have %d", tt.adj, i, tt.sizes[i], v.Size())
+			}
+		}
+	}
+
+	veins := FindVeins(blocks, EdgeAdjacent)
+	v := veins[0]
+
+	if v.Min != (Location{X: 100, Y: 10, Z: 100}) || v.Max != (Location{X: 102, Y: 11, Z: 100}) {
+		t.Fatalf("bounding box mismatch: have %v - %v", v.Min, v.Max)
+	}
+
+	if v.Centroid != (Location{X: 101, Y: 10, Z: 100}) {
+		t.Fatalf("centroid mismatch: have %v", v.Centroid)
+	}
+
+	SortVeinsByDistance(veins, Location{})
+
+	if veins[0].Blocks[0].X != 0 {
+		t.Fatalf("expected nearest vein first; have %v", veins[0].Centroid)
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	var c anvil.Chunk
+	c.Init(2, -1)
+	c.Biomes[0] = int8(biome.Jungle)
+
+	c.Section(10, true).Write(0, 10, 0, &anvil.Block{Id: item.DiamondOre})
+	c.Section(10, true).Write(1, 10, 0, &anvil.Block{Id: item.DiamondOre})
+	c.Section(20, true).Write(0, 4, 0, &anvil.Block{Id: item.GoldOre})
+
+	d := DistributeInChunk(&c, ByY, item.DiamondOre, item.GoldOre)
+
+	if have := d.Counts[Bucket{Y: 10}][item.DiamondOre]; have != 2 {
+		t.Fatalf("y=10: expected 2 diamond ore; have %d", have)
+	}
+
+	if have := d.Counts[Bucket{Y: 20}][item.GoldOre]; have != 1 {
+		t.Fatalf("y=20: expected 1 gold ore; have %d", have)
+	}
+
+	d = DistributeInChunk(&c, ByBiome, item.DiamondOre, item.GoldOre)
+
+	var buf bytes.Buffer
+	if err := d.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "biome,item,count\nPlains,DiamondOre,1\nJungle,GoldOre,1\nJungle,DiamondOre,1\n"
+	if buf.String() != want {
+		t.Fatalf("csv mismatch:\nHave: %q\nWant: %q", buf.String(), want)
+	}
+
+	d = DistributeInChunk(&c, ByChunk, item.GoldOre)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = `{"mode":"chunk","buckets":[{"chunk_x":2,"chunk_z":-1,"counts":{"GoldOre":1}}]}`
+	if string(data) != want {
+		t.Fatalf("json mismatch:\nHave: %s\nWant: %s", data, want)
+	}
+}
@@ -0,0 +1,467 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mcra
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kpfaulkner/mctools/anvil"
+	"github.com/kpfaulkner/mctools/anvil/biome"
+	"github.com/kpfaulkner/mctools/anvil/item"
+)
+
+// ParseQuery compiles a textual query into a Query value.
+//
+// A query is made up of conditions, combined with "and", "or", "not" and
+// parentheses. "and" binds tighter than "or". The following conditions
+// are supported:
+//
+//	id = Name                     Block has the given item id.
+//	id in (Name, ...)             Block has any of the given item ids.
+//	biome = Name                  Block is in the given biome.
+//	biome in (Name, ...)          Block is in any of the given biomes.
+//	x|y|z <|<=|>|>=|=|!= N        Block coordinate compares to N.
+//	blocklight|skylight <op> N    Block light level compares to N.
+//	exposed                       Block has air on at least one side.
+//
+// Item ids are given by name, as yielded by item.Id.String, or in the
+// numeric form accepted by item.ParseId. Biomes are given by name, as
+// yielded by biome.Id.String. Keywords and names are not case sensitive.
+//
+// A query may end with "within R of X,Y,Z", which limits all matches to
+// a radius of R blocks around the given point. For example:
+//
+//	id in (DiamondOre, RedstoneOre) and y < 16 and biome = Jungle within 100 of 0,64,0
+func ParseQuery(v string) (Query, error) {
+	p := parser{tokens: lex(v)}
+
+	q, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("mcra: parse query: %v", err)
+	}
+
+	return q, nil
+}
+
+// token is a single element of a textual query.
+type token struct {
+	text   string
+	offset int // Byte offset of the token in the query.
+}
+
+// lex splits a textual query into tokens. Words consist of letters,
+// digits and the characters '_', ':' and '-'. Operators and punctuation
+// form tokens of their own.
+func lex(v string) []token {
+	var out []token
+
+	for i := 0; i < len(v); {
+		r := rune(v[i])
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case isWordChar(r):
+			j := i
+			for j < len(v) && isWordChar(rune(v[j])) {
+				j++
+			}
+
+			out = append(out, token{v[i:j], i})
+			i = j
+
+		case strings.HasPrefix(v[i:], "<=") || strings.HasPrefix(v[i:], ">=") || strings.HasPrefix(v[i:], "!="):
+			out = append(out, token{v[i : i+2], i})
+			i += 2
+
+		default:
+			out = append(out, token{v[i : i+1], i})
+			i++
+		}
+	}
+
+	return out
+}
+
+// isWordChar returns true if r can be part of a word token.
+func isWordChar(r rune) bool {
+	return r == '_' || r == ':' || r == '-' ||
+		(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// parser compiles a list of tokens into a query, by recursive descent.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse parses a full query.
+func (p *parser) parse() (Query, error) {
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept("within") {
+		q, err = p.parseWithin(q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return q, nil
+}
+
+// parseOr parses: and { "or" and }
+func (p *parser) parseOr() (Query, error) {
+	return p.parseList("or", p.parseAnd, Or)
+}
+
+// parseAnd parses: unary { "and" unary }
+func (p *parser) parseAnd() (Query, error) {
+	return p.parseList("and", p.parseUnary, And)
+}
+
+// parseList parses one or more elements separated by the given keyword.
+// Multiple elements are combined with fn.
+func (p *parser) parseList(sep string, elem func() (Query, error), fn func(...Query) Query) (Query, error) {
+	var list []Query
+
+	for {
+		q, err := elem()
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, q)
+
+		if !p.accept(sep) {
+			break
+		}
+	}
+
+	if len(list) == 1 {
+		return list[0], nil
+	}
+
+	return fn(list...), nil
+}
+
+// parseUnary parses: "not" unary | "(" or ")" | condition
+func (p *parser) parseUnary() (Query, error) {
+	if p.accept("not") {
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return Not(q), nil
+	}
+
+	if p.accept("(") {
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		return q, p.expect(")")
+	}
+
+	return p.parseCondition()
+}
+
+// parseCondition parses a single condition.
+func (p *parser) parseCondition() (Query, error) {
+	name, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(name) {
+	case "id":
+		ids, err := p.parseSet(parseItem)
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]item.Id, len(ids))
+		for i, v := range ids {
+			items[i] = item.Id(v)
+		}
+
+		return NewInclusionQuery(items...), nil
+
+	case "biome":
+		ids, err := p.parseSet(parseBiome)
+		if err != nil {
+			return nil, err
+		}
+
+		biomes := make([]biome.Id, len(ids))
+		for i, v := range ids {
+			biomes[i] = biome.Id(v)
+		}
+
+		return NewBiomeQuery(biomes...), nil
+
+	case "x", "y", "z":
+		axis := strings.ToLower(name)
+		return p.parseCompare(func(min, max int) Query {
+			switch axis {
+			case "x":
+				return NewBoxQuery(min, math.MinInt32, math.MinInt32, max, math.MaxInt32, math.MaxInt32)
+			case "z":
+				return NewBoxQuery(math.MinInt32, math.MinInt32, min, math.MaxInt32, math.MaxInt32, max)
+			}
+
+			return NewYRangeQuery(min, max)
+		})
+
+	case "blocklight", "skylight":
+		sky := strings.EqualFold(name, "skylight")
+		return p.parseCompare(func(min, max int) Query {
+			return lightQuery(min, max, sky)
+		})
+
+	case "exposed":
+		return NewExposedQuery(), nil
+	}
+
+	p.pos--
+	return nil, p.errorf("unknown condition %q", name)
+}
+
+// parseSet parses: "=" value | "in" "(" value { "," value } ")"
+// Each value is converted by fn.
+func (p *parser) parseSet(fn func(string) (uint32, bool)) ([]uint32, error) {
+	var out []uint32
+
+	value := func() error {
+		v, err := p.next()
+		if err != nil {
+			return err
+		}
+
+		id, ok := fn(v)
+		if !ok {
+			p.pos--
+			return p.errorf("unknown name %q", v)
+		}
+
+		out = append(out, id)
+		return nil
+	}
+
+	if p.accept("=") {
+		return out, value()
+	}
+
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	for {
+		if err := value(); err != nil {
+			return nil, err
+		}
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	return out, p.expect(")")
+}
+
+// parseCompare parses: operator number
+// It passes the inclusive range of matching values to fn. The "!="
+// operator yields the negation of the "=" range.
+func (p *parser) parseCompare(fn func(min, max int) Query) (Query, error) {
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "<":
+		return fn(math.MinInt32, n-1), nil
+	case "<=":
+		return fn(math.MinInt32, n), nil
+	case ">":
+		return fn(n+1, math.MaxInt32), nil
+	case ">=":
+		return fn(n, math.MaxInt32), nil
+	case "=":
+		return fn(n, n), nil
+	case "!=":
+		return Not(fn(n, n)), nil
+	}
+
+	p.pos -= 2
+	return nil, p.errorf("expected comparison operator, found %q", op)
+}
+
+// parseWithin parses the remainder of: "within" radius "of" x "," y "," z
+func (p *parser) parseWithin(q Query) (Query, error) {
+	radius, err := p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+
+	if radius < 0 {
+		return nil, p.errorf("negative radius %d", radius)
+	}
+
+	if err = p.expect("of"); err != nil {
+		return nil, err
+	}
+
+	var xyz [3]int
+	for i := range xyz {
+		if i > 0 {
+			if err = p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		if xyz[i], err = p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+
+	origin := Location{X: xyz[0], Y: xyz[1], Z: xyz[2]}
+	return And(q, &distanceQuery{origin: origin, radius: uint(radius)}), nil
+}
+
+// parseInt parses a decimal integer.
+func (p *parser) parseInt() (int, error) {
+	v, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		p.pos--
+		return 0, p.errorf("expected number, found %q", v)
+	}
+
+	return int(n), nil
+}
+
+// next returns the next token.
+func (p *parser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", p.errorf("unexpected end of query")
+	}
+
+	p.pos++
+	return p.tokens[p.pos-1].text, nil
+}
+
+// accept consumes the next token if it equals v, without regard to case.
+func (p *parser) accept(v string) bool {
+	if p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos].text, v) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+// expect consumes the next token, which must equal v.
+func (p *parser) expect(v string) error {
+	if p.accept(v) {
+		return nil
+	}
+
+	if p.pos >= len(p.tokens) {
+		return p.errorf("expected %q, found end of query", v)
+	}
+
+	return p.errorf("expected %q, found %q", v, p.tokens[p.pos].text)
+}
+
+// errorf returns an error for the current token position.
+func (p *parser) errorf(f string, argv ...interface{}) error {
+	offset := -1
+	if p.pos < len(p.tokens) {
+		offset = p.tokens[p.pos].offset
+	}
+
+	if offset < 0 {
+		return fmt.Errorf(f, argv...)
+	}
+
+	return fmt.Errorf("offset %d: %s", offset, fmt.Sprintf(f, argv...))
+}
+
+// parseItem returns the item id for the given name or numeric id.
+func parseItem(v string) (uint32, bool) {
+	if id, ok := item.ParseId(v); ok {
+		return uint32(id), true
+	}
+
+	id, ok := item.Lookup(v)
+	return uint32(id), ok
+}
+
+// parseBiome returns the biome id for the given name.
+func parseBiome(v string) (uint32, bool) {
+	id, ok := biome.Parse(v)
+	return uint32(id), ok
+}
+
+// lightQuery returns a query for light levels in the range min-max,
+// limited to the range of valid light levels.
+func lightQuery(min, max int, sky bool) Query {
+	if min < 0 {
+		min = 0
+	}
+
+	if max > anvil.MaxLight {
+		max = anvil.MaxLight
+	}
+
+	if min > max {
+		return NewInclusionQuery() // Matches nothing.
+	}
+
+	if sky {
+		return NewSkyLightQuery(uint8(min), uint8(max))
+	}
+
+	return NewBlockLightQuery(uint8(min), uint8(max))
+}
+
+// distanceQuery finds all blocks within a given radius from a specific
+// world location, regardless of their type.
+type distanceQuery struct {
+	origin Location
+	radius uint
+}
+
+// IsTarget returns true if the given block should be
+// included in the result set.
+func (q *distanceQuery) IsTarget(b Block) bool {
+	return q.origin.DistanceTo(b.Location) <= q.radius && q.origin.SameDimension(b.Location)
+}
@@ -6,12 +6,92 @@ package mcra
 import "github.com/kpfaulkner/mctools/anvil/item"
 
 // Query defines a generic search query.
+//
+// Queries which look at more than a block's id and location implement
+// ChunkQuery. Without a chunk to look at, these never match: their
+// IsTarget method returns false, as does that of a Not query wrapping
+// them.
 type Query interface {
 	// IsTarget returns true if the given block should be
 	// included in the result set.
 	IsTarget(Block) bool
 }
 
+// CandidateQuery is implemented by queries which only match blocks with
+// specific item ids. Searches use it to skip entire sections which hold
+// none of the candidates, without reading each block.
+type CandidateQuery interface {
+	Query
+
+	// Candidates returns the item ids a block must have to be
+	// a possible target. It returns false if any block may be
+	// a target.
+	Candidates() ([]item.Id, bool)
+}
+
+// ChunkQuery is implemented by queries which look at more than a block's
+// id and location, like its light level or neighbours. Searches call
+// IsTargetInChunk instead of IsTarget for these.
+type ChunkQuery interface {
+	Query
+
+	// IsTargetInChunk returns true if the given block, taken from
+	// the chunk in v, should be included in the result set.
+	IsTargetInChunk(v *ChunkView, b Block) bool
+}
+
+// isTarget returns true if block b, taken from the chunk in v, matches
+// query q. The view may be nil if the chunk is not known.
+func isTarget(q Query, v *ChunkView, b Block) bool {
+	if cq, ok := q.(ChunkQuery); ok && v != nil {
+		return cq.IsTargetInChunk(v, b)
+	}
+
+	return q.IsTarget(b)
+}
+
+// needsChunk returns true if q can not be evaluated without the chunk
+// holding a block.
+func needsChunk(q Query) bool {
+	switch q := q.(type) {
+	case AndQuery:
+		for _, v := range q {
+			if needsChunk(v) {
+				return true
+			}
+		}
+
+		return false
+
+	case OrQuery:
+		for _, v := range q {
+			if needsChunk(v) {
+				return true
+			}
+		}
+
+		return false
+
+	case *NotQuery:
+		return needsChunk(q.q)
+
+	case ChunkQuery:
+		return true
+	}
+
+	return false
+}
+
+// candidates returns the item ids a block must have to match q.
+// It returns false if any block may match.
+func candidates(q Query) ([]item.Id, bool) {
+	if cq, ok := q.(CandidateQuery); ok {
+		return cq.Candidates()
+	}
+
+	return nil, false
+}
+
 // RadiusQuery finds all listed items within a given radius from a
 // specific world location.
 type RadiusQuery struct {
@@ -36,13 +116,17 @@ func (q *RadiusQuery) IsTarget(b Block) bool {
 	for _, v := range q.items {
 		if v == b.Id {
 			dist := q.origin.DistanceTo(b.Location)
-			return dist <= q.radius
+			return dist <= q.radius && q.origin.SameDimension(b.Location)
 		}
 	}
 
 	return false
 }
 
+// Candidates returns the item ids a block must have to be
+// a possible target.
+func (q *RadiusQuery) Candidates() ([]item.Id, bool) { return q.items, true }
+
 // InclusionQuery defines an inclusion search.
 // This means that the result set will contain only item types included
 // in this query.
@@ -65,6 +149,10 @@ func (q InclusionQuery) IsTarget(b Block) bool {
 	return false
 }
 
+// Candidates returns the item ids a block must have to be
+// a possible target.
+func (q InclusionQuery) Candidates() ([]item.Id, bool) { return q, true }
+
 // ExclusionQuery defines an exclusion search.
 // This means that the result set will contain only item types NOT included
 // in this query.
@@ -86,3 +174,178 @@ func (q ExclusionQuery) IsTarget(b Block) bool {
 
 	return true
 }
+
+// BoxQuery finds all blocks inside a box of absolute world coordinates.
+type BoxQuery struct {
+	min, max [3]int
+}
+
+// NewBoxQuery creates a new query for the box spanning the two given
+// corners. Both corners are included in the box.
+func NewBoxQuery(x0, y0, z0, x1, y1, z1 int) Query {
+	var q BoxQuery
+
+	for i, v := range [...][2]int{{x0, x1}, {y0, y1}, {z0, z1}} {
+		if v[0] > v[1] {
+			v[0], v[1] = v[1], v[0]
+		}
+
+		q.min[i], q.max[i] = v[0], v[1]
+	}
+
+	return &q
+}
+
+// IsTarget returns true if the given block should be
+// included in the result set.
+func (q *BoxQuery) IsTarget(b Block) bool {
+	return b.X >= q.min[0] && b.X <= q.max[0] &&
+		b.Y >= q.min[1] && b.Y <= q.max[1] &&
+		b.Z >= q.min[2] && b.Z <= q.max[2]
+}
+
+// YRangeQuery finds all blocks between two heights.
+type YRangeQuery struct {
+	min, max int
+}
+
+// NewYRangeQuery creates a new query for blocks with a Y coordinate in the
+// range min-max, inclusive.
+func NewYRangeQuery(min, max int) Query {
+	return &YRangeQuery{min: min, max: max}
+}
+
+// IsTarget returns true if the given block should be
+// included in the result set.
+func (q *YRangeQuery) IsTarget(b Block) bool {
+	return b.Y >= q.min && b.Y <= q.max
+}
+
+// AndQuery matches blocks which match all of its queries.
+type AndQuery []Query
+
+// And creates a query matching blocks which match all of the given queries.
+func And(q ...Query) Query {
+	return AndQuery(q)
+}
+
+// IsTarget returns true if the given block should be
+// included in the result set.
+func (q AndQuery) IsTarget(b Block) bool {
+	return q.IsTargetInChunk(nil, b)
+}
+
+// IsTargetInChunk returns true if the given block, taken from
+// the chunk in v, should be included in the result set.
+func (q AndQuery) IsTargetInChunk(v *ChunkView, b Block) bool {
+	for _, sub := range q {
+		if !isTarget(sub, v, b) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Candidates returns the item ids a block must have to be
+// a possible target. These are the ids shared by all queries which
+// define candidates.
+func (q AndQuery) Candidates() ([]item.Id, bool) {
+	var out []item.Id
+	var found bool
+
+	for _, v := range q {
+		ids, ok := candidates(v)
+		if !ok {
+			continue
+		}
+
+		if !found {
+			out = append(out, ids...)
+			found = true
+			continue
+		}
+
+		shared := out[:0]
+		for _, id := range out {
+			if hasItem(ids, id) {
+				shared = append(shared, id)
+			}
+		}
+
+		out = shared
+	}
+
+	return out, found
+}
+
+// OrQuery matches blocks which match any of its queries.
+type OrQuery []Query
+
+// Or creates a query matching blocks which match any of the given queries.
+func Or(q ...Query) Query {
+	return OrQuery(q)
+}
+
+// IsTarget returns true if the given block should be
+// included in the result set.
+func (q OrQuery) IsTarget(b Block) bool {
+	return q.IsTargetInChunk(nil, b)
+}
+
+// IsTargetInChunk returns true if the given block, taken from
+// the chunk in v, should be included in the result set.
+func (q OrQuery) IsTargetInChunk(v *ChunkView, b Block) bool {
+	for _, sub := range q {
+		if isTarget(sub, v, b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Candidates returns the item ids a block must have to be
+// a possible target. This is only known if all queries define
+// candidates.
+func (q OrQuery) Candidates() ([]item.Id, bool) {
+	var out []item.Id
+
+	for _, v := range q {
+		ids, ok := candidates(v)
+		if !ok {
+			return nil, false
+		}
+
+		out = append(out, ids...)
+	}
+
+	return out, true
+}
+
+// NotQuery matches blocks which do not match its query.
+type NotQuery struct {
+	q Query
+}
+
+// Not creates a query matching blocks which do not match the given query.
+func Not(q Query) Query {
+	return &NotQuery{q: q}
+}
+
+// IsTarget returns true if the given block should be
+// included in the result set. It returns false if the query needs
+// the chunk holding the block to decide.
+func (q *NotQuery) IsTarget(b Block) bool {
+	if needsChunk(q.q) {
+		return false
+	}
+
+	return !q.q.IsTarget(b)
+}
+
+// IsTargetInChunk returns true if the given block, taken from
+// the chunk in v, should be included in the result set.
+func (q *NotQuery) IsTargetInChunk(v *ChunkView, b Block) bool {
+	return !isTarget(q.q, v, b)
+}
@@ -4,6 +4,8 @@
 package mcra
 
 import (
+	"context"
+
 	"github.com/kpfaulkner/mctools/anvil"
 	"github.com/kpfaulkner/mctools/anvil/item"
 )
@@ -17,20 +19,20 @@ type TallyResult map[item.Id]uint64
 //
 // If the given item set is empty, all blocks will be counted.
 func TallyInRegion(r *anvil.Region, items ...item.Id) TallyResult {
-	var chunk anvil.Chunk
 	out := make(TallyResult)
-
-	for _, xz := range r.Chunks() {
-		if !r.ReadChunk(xz[0], xz[1], &chunk) {
-			continue
-		}
-
-		tallyInChunk(&chunk, items, out)
-	}
-
+	tallyChunks(context.Background(), regionChunks(r), items, out)
 	return out
 }
 
+// tallyChunks counts the given items in the chunks from src. It stops
+// early if ctx is cancelled and returns its error.
+func tallyChunks(ctx context.Context, src chunkSource, items []item.Id, out TallyResult) error {
+	return src(ctx, func(v *ChunkView) bool {
+		tallyInChunk(v.Chunk, items, out)
+		return true
+	})
+}
+
 // TallyInChunk counts the number of times each of the given items occurs
 // in the specified chunk.
 //
@@ -43,6 +45,10 @@ func TallyInChunk(c *anvil.Chunk, items ...item.Id) TallyResult {
 
 func tallyInChunk(c *anvil.Chunk, items []item.Id, out TallyResult) {
 	for i := range c.Sections {
+		if len(items) > 0 && !c.Sections[i].ContainsAny(items...) {
+			continue
+		}
+
 		tallyInSection(&c.Sections[i], items, out)
 	}
 }
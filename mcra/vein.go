@@ -0,0 +1,215 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mcra
+
+import (
+	"math"
+	"sort"
+
+	"github.com/kpfaulkner/mctools/anvil/item"
+)
+
+// Adjacency defines which neighbouring blocks are part of the same vein.
+type Adjacency int
+
+// Known adjacency modes.
+const (
+	FaceAdjacent Adjacency = iota // Blocks sharing a face; 6 neighbours.
+	EdgeAdjacent                  // Blocks sharing a face or an edge; 18 neighbours.
+)
+
+// Vein defines a group of adjacent blocks with the same id, like a vein
+// of ore.
+type Vein struct {
+	Id       item.Id   // Type of block in this vein.
+	Blocks   BlockList // Blocks in the vein, in the order they were found.
+	Min      Location  // Lowest corner of the vein's bounding box.
+	Max      Location  // Highest corner of the vein's bounding box.
+	Centroid Location  // Average location of all blocks, rounded to the nearest block.
+}
+
+// Size returns the number of blocks in the vein.
+func (v *Vein) Size() int { return len(v.Blocks) }
+
+// FindVeins groups the given blocks into veins of adjacent blocks with the
+// same id, in the same dimension. Duplicate locations are counted once.
+//
+// Veins are returned in the order of their first block in the list.
+func FindVeins(blocks BlockList, adj Adjacency) []Vein {
+	index := make(map[Location]int, len(blocks))
+	parent := make([]int, len(blocks))
+
+	for i := range blocks {
+		if _, ok := index[blocks[i].Location]; ok {
+			parent[i] = -1 // Duplicate.
+			continue
+		}
+
+		index[blocks[i].Location] = i
+		parent[i] = i
+	}
+
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+
+		return i
+	}
+
+	offsets := neighbours(adj)
+
+	for i := range blocks {
+		if parent[i] < 0 {
+			continue
+		}
+
+		for _, o := range offsets {
+			loc := blocks[i].Location
+			loc.X += o[0]
+			loc.Y += o[1]
+			loc.Z += o[2]
+
+			j, ok := index[loc]
+			if !ok || blocks[j].Id != blocks[i].Id {
+				continue
+			}
+
+			if a, b := find(i), find(j); a != b {
+				parent[b] = a
+			}
+		}
+	}
+
+	var out []Vein
+	veins := make(map[int]int) // Root block index -> vein index.
+
+	for i := range blocks {
+		if parent[i] < 0 {
+			continue
+		}
+
+		root := find(i)
+
+		n, ok := veins[root]
+		if !ok {
+			n = len(out)
+			veins[root] = n
+			out = append(out, Vein{Id: blocks[i].Id})
+		}
+
+		out[n].Blocks = append(out[n].Blocks, blocks[i])
+	}
+
+	for i := range out {
+		out[i].measure()
+	}
+
+	return out
+}
+
+// SortVeinsByDistance sorts veins by the distance of their centroid to the
+// given location, nearest first. Veins in a different dimension than the
+// location are moved to the end.
+func SortVeinsByDistance(veins []Vein, from Location) {
+	sort.SliceStable(veins, func(i, j int) bool {
+		a, b := &veins[i].Centroid, &veins[j].Centroid
+
+		if sa, sb := a.SameDimension(from), b.SameDimension(from); sa != sb {
+			return sa
+		}
+
+		return distanceSq(*a, from) < distanceSq(*b, from)
+	})
+}
+
+// measure computes the bounding box and centroid of the vein.
+func (v *Vein) measure() {
+	if len(v.Blocks) == 0 {
+		return
+	}
+
+	v.Min = v.Blocks[0].Location
+	v.Max = v.Blocks[0].Location
+
+	var sx, sy, sz float64
+
+	for _, b := range v.Blocks {
+		v.Min.X = minInt(v.Min.X, b.X)
+		v.Min.Y = minInt(v.Min.Y, b.Y)
+		v.Min.Z = minInt(v.Min.Z, b.Z)
+		v.Max.X = maxInt(v.Max.X, b.X)
+		v.Max.Y = maxInt(v.Max.Y, b.Y)
+		v.Max.Z = maxInt(v.Max.Z, b.Z)
+
+		sx += float64(b.X)
+		sy += float64(b.Y)
+		sz += float64(b.Z)
+	}
+
+	n := float64(len(v.Blocks))
+	v.Centroid = Location{
+		X:         int(math.Floor(sx/n + 0.5)),
+		Y:         int(math.Floor(sy/n + 0.5)),
+		Z:         int(math.Floor(sz/n + 0.5)),
+		Dimension: v.Min.Dimension,
+	}
+}
+
+// neighbours returns the offsets of all neighbours of a block, for the
+// given adjacency mode.
+func neighbours(adj Adjacency) [][3]int {
+	limit := 1
+	if adj == EdgeAdjacent {
+		limit = 2
+	}
+
+	var out [][3]int
+
+	for x := -1; x <= 1; x++ {
+		for y := -1; y <= 1; y++ {
+			for z := -1; z <= 1; z++ {
+				n := absInt(x) + absInt(y) + absInt(z)
+				if n > 0 && n <= limit {
+					out = append(out, [3]int{x, y, z})
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// distanceSq returns the squared distance between two locations.
+func distanceSq(a, b Location) float64 {
+	dx := float64(a.X - b.X)
+	dy := float64(a.Y - b.Y)
+	dz := float64(a.Z - b.Z)
+	return dx*dx + dy*dy + dz*dz
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
@@ -0,0 +1,222 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mcra
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kpfaulkner/mctools"
+	"github.com/kpfaulkner/mctools/anvil"
+)
+
+// VisitFunc is called for each block matching a query. It returns false
+// to stop the search.
+type VisitFunc func(Block) bool
+
+// visitBatchSize is the number of matches a world scan hands from its
+// workers to the visitor at once.
+const visitBatchSize = 4096
+
+// errStopped is returned internally when a visitor stops a search.
+var errStopped = errors.New("mcra: search stopped")
+
+// VisitRegion calls fn for each block in the specified region, matching
+// the given query, until fn returns false. Matches are passed on as they
+// are found, without being collected in memory.
+func VisitRegion(r *anvil.Region, q Query, fn VisitFunc) {
+	visitChunks(context.Background(), regionChunks(r), "", q, fn)
+}
+
+// VisitChunk calls fn for each block in the specified chunk, matching
+// the given query, until fn returns false. Queries do not have access to
+// neighbouring chunks.
+func VisitChunk(c *anvil.Chunk, q Query, fn VisitFunc) {
+	visitChunk(&ChunkView{Chunk: c, X: int(c.X), Z: int(c.Z)}, q, "", fn)
+}
+
+// VisitWorld calls fn for each block in the given dimension of a world,
+// matching the specified query, until fn returns false.
+//
+// Regions are scanned concurrently, as with FindInWorld, but fn is only
+// called from a single goroutine and sees blocks in the same order
+// FindInWorld returns them. Workers which get too far ahead of fn wait
+// for it, which bounds memory use regardless of the number of matches.
+// The location of each block holds the given dimension.
+//
+// Returns nil if all blocks were visited or fn stopped the search.
+func VisitWorld(ctx context.Context, w *mctools.World, dim string, q Query, opt *ScanOptions, fn VisitFunc) error {
+	var settings ScanOptions
+	if opt != nil {
+		settings = *opt
+	}
+
+	// Progress is reported here, as regions are handed to fn in order.
+	progress := settings.Progress
+	settings.Progress = nil
+
+	regions := worldRegions(w, dim)
+	batches := make([]chan BlockList, len(regions))
+
+	for i := range batches {
+		batches[i] = make(chan BlockList, 4)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	scanErr := make(chan error, 1)
+
+	go func() {
+		err := scanWorld(ctx, w, dim, regions, &settings, func(ctx context.Context, i int, src chunkSource) error {
+			defer close(batches[i])
+
+			var batch BlockList
+			send := func() bool {
+				select {
+				case batches[i] <- batch:
+					batch = nil
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			err := visitChunks(ctx, src, dim, q, func(b Block) bool {
+				batch = append(batch, b)
+				return len(batch) < visitBatchSize || send()
+			})
+
+			if err == nil && len(batch) > 0 && !send() {
+				err = ctx.Err()
+			}
+
+			if err == errStopped {
+				err = ctx.Err()
+			}
+
+			return err
+		})
+
+		// Regions which are not scanned after an error never close
+		// their channel; make sure the visitor does not wait for them.
+		if err != nil {
+			cancel()
+		}
+
+		scanErr <- err
+	}()
+
+	if visitBatches(ctx, batches, progress, fn) == errStopped {
+		cancel()
+		<-scanErr
+		return nil
+	}
+
+	return <-scanErr
+}
+
+// visitBatches passes the blocks from each channel to fn, in order.
+// It returns errStopped if fn stops the search, or the context's error if
+// ctx is cancelled.
+func visitBatches(ctx context.Context, batches []chan BlockList, progress ProgressFunc, fn VisitFunc) error {
+	for i := range batches {
+		for {
+			var batch BlockList
+			var ok bool
+
+			select {
+			case batch, ok = <-batches[i]:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			if !ok {
+				break
+			}
+
+			for _, b := range batch {
+				if !fn(b) {
+					return errStopped
+				}
+			}
+		}
+
+		if progress != nil {
+			progress(i+1, len(batches))
+		}
+	}
+
+	return nil
+}
+
+// visitChunks calls fn for all blocks in the chunks from src, matching
+// the given query. It returns errStopped if fn stops the search, or the
+// context's error if ctx is cancelled.
+func visitChunks(ctx context.Context, src chunkSource, dim string, q Query, fn VisitFunc) error {
+	return src(ctx, func(v *ChunkView) bool {
+		return visitChunk(v, q, dim, fn)
+	})
+}
+
+// visitChunk calls fn for all blocks in the chunk of the given view,
+// matching the given query. Block locations hold the given dimension.
+// Returns false if fn stopped the search.
+func visitChunk(v *ChunkView, q Query, dim string, fn VisitFunc) bool {
+	c := v.Chunk
+	loc := Block{
+		Location: Location{
+			X:         v.X * anvil.BlocksPerChunk,
+			Z:         v.Z * anvil.BlocksPerChunk,
+			Dimension: dim,
+		},
+	}
+
+	ids, filter := candidates(q)
+
+	for i := range c.Sections {
+		if filter && !c.Sections[i].ContainsAny(ids...) {
+			continue
+		}
+
+		loc.Y = int(c.Sections[i].Y) * anvil.BlocksPerSection
+
+		if !visitSection(v, &c.Sections[i], q, loc, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// visitSection calls fn for all blocks in the specified section, matching
+// the given query. The section's origin is at loc. Returns false if fn
+// stopped the search.
+func visitSection(v *ChunkView, s *anvil.Section, q Query, loc Block, fn VisitFunc) bool {
+	var x, y, z int
+	var block anvil.Block
+
+	ox, oy, oz := loc.X, loc.Y, loc.Z
+
+	for y = 0; y < 16; y++ {
+		for x = 0; x < anvil.BlocksPerChunk; x++ {
+			for z = 0; z < anvil.BlocksPerChunk; z++ {
+				loc.X = ox + x
+				loc.Y = oy + y
+				loc.Z = oz + z
+
+				if !s.Read(x, y, z, &block) {
+					continue
+				}
+
+				loc.Id = block.Id
+				if isTarget(q, v, loc) && !fn(loc) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
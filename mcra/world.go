@@ -0,0 +1,342 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mcra
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/kpfaulkner/mctools"
+	"github.com/kpfaulkner/mctools/anvil"
+	"github.com/kpfaulkner/mctools/anvil/item"
+)
+
+// ProgressFunc is called after each region of a world scan has been
+// completed, with the number of completed regions and the total number
+// of regions in the scan.
+type ProgressFunc func(done, total int)
+
+// ScanOptions defines settings for world-wide scans.
+// The zero value is ready to use.
+type ScanOptions struct {
+	// Workers is the number of regions scanned concurrently.
+	// It defaults to runtime.NumCPU(). Each worker may need its own
+	// region and two neighbouring ones, so the number is capped at a
+	// third of the world's MaxRegions, to keep them in its cache.
+	Workers int
+
+	// Progress, if set, is called after each completed region. Calls
+	// are made from a single goroutine, one at a time.
+	Progress ProgressFunc
+}
+
+// FindInWorld locates all blocks in the given dimension of a world,
+// matching the specified query. Regions are scanned concurrently.
+//
+// The result holds blocks in the same order as calling FindInRegion on
+// each region in turn, sorted by region X, then Z. The scan stops at the
+// first region which can not be opened, the first chunk which can not be
+// decoded, or when ctx is cancelled.
+// The query must be safe for concurrent use. Unlike FindInRegion, the
+// location of each block holds the given dimension.
+//
+// Chunks are read through the world's cache, so changes made with
+// World.SetBlock are found before they are flushed, and repeated scans
+// do not decode the same chunks again.
+//
+// All matches are kept in memory. Use VisitWorld for queries which may
+// match large parts of the world.
+func FindInWorld(ctx context.Context, w *mctools.World, dim string, q Query, opt *ScanOptions) (BlockList, error) {
+	var out BlockList
+
+	err := VisitWorld(ctx, w, dim, q, opt, func(b Block) bool {
+		out = append(out, b)
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// TallyInWorld counts the number of times each of the given items occurs
+// in the given dimension of a world. Regions are scanned concurrently.
+//
+// If the given item set is empty, all blocks will be counted. The scan
+// stops at the first region which can not be opened, the first chunk
+// which can not be decoded, or when ctx is cancelled. Chunks are read
+// through the world's cache, as with FindInWorld.
+func TallyInWorld(ctx context.Context, w *mctools.World, dim string, opt *ScanOptions, items ...item.Id) (TallyResult, error) {
+	regions := worldRegions(w, dim)
+	results := make([]TallyResult, len(regions))
+
+	err := scanWorld(ctx, w, dim, regions, opt, func(ctx context.Context, i int, src chunkSource) error {
+		results[i] = make(TallyResult)
+		return tallyChunks(ctx, src, items, results[i])
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(TallyResult)
+	for _, set := range results {
+		for id, n := range set {
+			out[id] += n
+		}
+	}
+
+	return out, nil
+}
+
+// worldRegions returns the coordinates of all regions in the given
+// dimension, sorted by X, then Z.
+func worldRegions(w *mctools.World, dim string) [][2]int {
+	regions := append([][2]int(nil), w.Regions()[dim]...)
+
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i][0] != regions[j][0] {
+			return regions[i][0] < regions[j][0]
+		}
+
+		return regions[i][1] < regions[j][1]
+	})
+
+	return regions
+}
+
+// chunkFunc is called for each chunk in a scan. It returns false to stop
+// the scan.
+type chunkFunc func(v *ChunkView) bool
+
+// chunkSource calls fn for each chunk of a single region, until fn returns
+// false. It returns errStopped if fn stopped the scan, or the context's
+// error if ctx is cancelled.
+type chunkSource func(ctx context.Context, fn chunkFunc) error
+
+// regionChunks returns a source for the chunks of region r. Chunks which
+// can not be read are skipped. Neighbouring chunks are available to the
+// view as long as they lie in the same region.
+func regionChunks(r *anvil.Region) chunkSource {
+	return func(ctx context.Context, fn chunkFunc) error {
+		// Chunks are visited row by row, so only the rows around the
+		// current chunk are kept. Nil entries mark missing chunks.
+		window := make(map[[2]int]*anvil.Chunk)
+
+		read := func(x, z int) *anvil.Chunk {
+			if x < 0 || z < 0 || x >= anvil.ChunksPerRegion || z >= anvil.ChunksPerRegion {
+				return nil
+			}
+
+			c, ok := window[[2]int{x, z}]
+			if !ok {
+				c = new(anvil.Chunk)
+				if !r.ReadChunk(x, z, c) {
+					c = nil
+				}
+
+				window[[2]int{x, z}] = c
+			}
+
+			return c
+		}
+
+		ox := r.X * anvil.ChunksPerRegion
+		oz := r.Z * anvil.ChunksPerRegion
+
+		view := ChunkView{
+			lookup: func(cx, cz int) *anvil.Chunk {
+				return read(cx-ox, cz-oz)
+			},
+		}
+
+		for _, xz := range r.Chunks() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			for k := range window {
+				if k[1] < xz[1]-1 {
+					delete(window, k)
+				}
+			}
+
+			view.Chunk = read(xz[0], xz[1])
+			if view.Chunk == nil {
+				continue
+			}
+
+			view.X = ox + xz[0]
+			view.Z = oz + xz[1]
+
+			if !fn(&view) {
+				return errStopped
+			}
+		}
+
+		return nil
+	}
+}
+
+// worldChunks returns a source for the chunks of the region at the given
+// coordinates in a world. Chunks are read through the world's cache, so
+// they include changes which have not been flushed, and are decoded only
+// once for repeated scans. A chunk which can not be decoded stops the
+// scan with a *anvil.ChunkError. All chunks in the dimension are
+// available to the view as neighbours.
+func worldChunks(w *mctools.World, dim string, xz [2]int) chunkSource {
+	return func(ctx context.Context, fn chunkFunc) error {
+		list, err := w.RegionChunks(dim, xz[0], xz[1])
+		if err != nil {
+			return err
+		}
+
+		view := ChunkView{
+			lookup: func(cx, cz int) *anvil.Chunk {
+				c, err := w.Chunk(dim, cx, cz)
+				if err != nil {
+					return nil
+				}
+
+				return c
+			},
+		}
+
+		for _, cxz := range list {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			c, err := w.Chunk(dim, cxz[0], cxz[1])
+			if errors.Is(err, mctools.ErrChunkNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			view.Chunk = c
+			view.X, view.Z = cxz[0], cxz[1]
+
+			if !fn(&view) {
+				return errStopped
+			}
+		}
+
+		return nil
+	}
+}
+
+// scanFunc scans the chunks from src, which hold regions[i] of a world scan.
+type scanFunc func(ctx context.Context, i int, src chunkSource) error
+
+// scanWorld passes the chunks of the given regions to fn, one region at
+// a time, using a pool of workers. It returns the first error encountered,
+// if any, after all workers have stopped.
+func scanWorld(ctx context.Context, w *mctools.World, dim string, regions [][2]int, opt *ScanOptions, fn scanFunc) error {
+	var settings ScanOptions
+	if opt != nil {
+		settings = *opt
+	}
+
+	workers := settings.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	// Neighbour lookups open the regions next to the one being scanned;
+	// a chunk in the corner of a region touches two of them.
+	open := w.MaxRegions
+	if open <= 0 {
+		open = mctools.DefaultMaxRegions
+	}
+
+	if workers > open/3 {
+		workers = open / 3
+	}
+
+	if workers > len(regions) {
+		workers = len(regions)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	done := make(chan error)
+
+	go func() {
+		defer close(jobs)
+
+		for i := range regions {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for n := 0; n < workers; n++ {
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				done <- scanRegion(ctx, w, dim, regions[i], i, fn)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	var count int
+
+	for rerr := range done {
+		if rerr != nil {
+			if err == nil {
+				err = rerr
+				cancel()
+			}
+
+			continue
+		}
+
+		count++
+		if settings.Progress != nil && err == nil {
+			settings.Progress(count, len(regions))
+		}
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	return err
+}
+
+// scanRegion passes the chunks of the region at the given coordinates to fn.
+func scanRegion(ctx context.Context, w *mctools.World, dim string, xz [2]int, i int, fn scanFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return fn(ctx, i, worldChunks(w, dim, xz))
+}
@@ -24,6 +24,14 @@ type World struct {
 	*anvil.Level                     // level.dat contents.
 	root         string              // Directory with world data.
 	regions      map[string][][2]int // List of known regions in this world - grouped by dimension.
+	cache        cache               // Regions and chunks loaded for block access.
+
+	// MaxMemory limits the estimated memory used by decoded chunks in
+	// the cache, in bytes. MaxRegions limits the number of regions kept
+	// open. Zero selects DefaultMaxMemory and DefaultMaxRegions
+	// respectively.
+	MaxMemory  int64
+	MaxRegions int
 }
 
 // Open opens a new world in the given root directory.
@@ -35,6 +43,8 @@ func Open(root string) (*World, error) {
 		regions: make(map[string][][2]int),
 	}
 
+	w.cache.init()
+
 	// Load level.dat
 	w.Level, err = anvil.LoadLevel(filepath.Join(root, "level.dat"))
 	if err != nil {
@@ -49,10 +59,17 @@ func Open(root string) (*World, error) {
 }
 
 // Save saves the level.dat information for this world.
+// The file is replaced atomically; see anvil.Level.Save.
 func (w *World) Save() error {
 	return w.Level.Save(filepath.Join(w.root, "level.dat"))
 }
 
+// SaveWithBackup saves the level.dat information for this world, like
+// Save. The previous version is kept in level.dat_old, as Minecraft does.
+func (w *World) SaveWithBackup() error {
+	return w.Level.SaveWithBackup(filepath.Join(w.root, "level.dat"))
+}
+
 // Regions returns the coordinates for all regions in the world.
 // This yields a map which groups region X/Z pairs for each dimension.
 func (w *World) Regions() map[string][][2]int { return w.regions }
@@ -61,10 +78,14 @@ func (w *World) Regions() map[string][][2]int { return w.regions }
 //
 // If you have an open handle to this region, close it before calling this,
 // as accessing its data afterwards will have undefined behaviour.
+// Chunks of this region held in the world's cache are discarded, along
+// with any changes which have not been flushed.
 //
 // Note that this permanently deletes the region file from disk.
 // This operation can not be undone.
 func (w *World) DeleteRegion(dim string, x, z int) error {
+	w.dropRegion(regionKey{dim, x, z})
+
 	file := w.regionFile(dim, x, z)
 	err := os.Remove(file)
 
@@ -106,6 +127,20 @@ func (w *World) LoadRegion(dim string, x, z int) (*anvil.Region, error) {
 	return region, nil
 }
 
+// OpenRegion opens the given region in the specified dimension.
+// Chunk data is read from disk as it is accessed; the caller must call
+// Region.Close when done with it.
+func (w *World) OpenRegion(dim string, x, z int) (*anvil.Region, error) {
+	file := w.regionFile(dim, x, z)
+	region, err := anvil.OpenRegion(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("mctools: open region %d.%d: %v", x, z, err)
+	}
+
+	return region, nil
+}
+
 // regionFile returns the full region file path for the given dimension and
 // coordinates.
 func (w *World) regionFile(dim string, x, z int) string {
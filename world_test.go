@@ -0,0 +1,35 @@
+// This file is subject to a 1-clause BSD license.
+// Its contents can be found in the enclosed LICENSE file.
+
+package mctools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kpfaulkner/mctools/anvil"
+)
+
+func TestWorldSave(t *testing.T) {
+	w := testWorld(t)
+	defer w.Close()
+
+	backup := filepath.Join(w.root, "level.dat"+anvil.LevelBackupSuffix)
+
+	if err := w.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup after Save; have %v", err)
+	}
+
+	if err := w.SaveWithBackup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(backup); err != nil {
+		t.Fatalf("expected a backup after SaveWithBackup: %v", err)
+	}
+}